@@ -70,6 +70,21 @@ def process_message(message):
             'timestamp': {'S': body['timestamp']}
         }
         
+        # Campos opcionais (ambiente, flags multivariadas e motivo da decisão)
+        if body.get('environment'):
+            item['environment'] = {'S': body['environment']}
+        if body.get('variation'):
+            item['variation'] = {'S': body['variation']}
+        reason = body.get('reason') or {}
+        if reason.get('kind'):
+            item['reason'] = {'S': reason['kind']}
+        if reason.get('rule_id'):
+            item['rule_id'] = {'S': reason['rule_id']}
+        if reason.get('error_kind'):
+            item['error_kind'] = {'S': reason['error_kind']}
+        if 'holdout' in body:
+            item['holdout'] = {'BOOL': body['holdout']}
+        
         # Insere no DynamoDB
         dynamodb_client.put_item(
             TableName=DYNAMODB_TABLE_NAME,
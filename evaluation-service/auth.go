@@ -0,0 +1,46 @@
+package main
+
+import (
+	"log"
+	"net/http"
+)
+
+// --- Middleware ---
+
+// requireAuth protege os endpoints administrativos validando a chave de API
+// contra o /validate do auth-service (mesmo esquema do require_auth dos serviços Python)
+func (a *App) requireAuth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if a.AuthServiceURL == "" {
+			http.Error(w, `{"error": "Endpoints administrativos desabilitados (AUTH_SERVICE_URL não definida)"}`, http.StatusServiceUnavailable)
+			return
+		}
+
+		authHeader := r.Header.Get("Authorization")
+		if authHeader == "" {
+			http.Error(w, `{"error": "Authorization header obrigatório"}`, http.StatusUnauthorized)
+			return
+		}
+
+		// Chama o /validate do auth-service
+		req, _ := http.NewRequest("GET", a.AuthServiceURL+"/validate", nil)
+		req.Header.Set("Authorization", authHeader)
+
+		resp, err := a.HttpClient.Do(req)
+		if err != nil {
+			log.Printf("Erro ao conectar com o auth-service: %v", err)
+			http.Error(w, `{"error": "Serviço de autenticação indisponível"}`, http.StatusServiceUnavailable)
+			return
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			log.Printf("Falha na validação da chave (status: %d)", resp.StatusCode)
+			http.Error(w, `{"error": "Chave de API inválida"}`, http.StatusUnauthorized)
+			return
+		}
+
+		// Se a chave for válida, continua para o handler principal
+		next(w, r)
+	}
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Big segments: coortes grandes demais para o JSONB de uma regra (ex: milhões
+// de IDs exportados do data warehouse) ficam em SETs do Redis.
+// Cada upload grava uma nova versão em um set próprio e, no final, ela é
+// trocada atomicamente (RENAME) pelo set ativo, então a avaliação nunca
+// enxerga um set pela metade. Como as flags, cada big segment existe
+// separadamente em cada ambiente.
+//
+//	big_segment:{<ambiente>:<nome>}:seq      -> contador de versões (INCR)
+//	big_segment:{<ambiente>:<nome>}:current  -> versão ativa
+//	big_segment:{<ambiente>:<nome>}:members  -> SET com os IDs da versão ativa
+//	big_segment:{<ambiente>:<nome>}:v<N>     -> SET da versão N durante o upload
+//
+// A hash tag ({...}) coloca todas as chaves de um big segment no mesmo slot
+// do Redis Cluster, e os scripts recebem todas elas em KEYS.
+
+// Quantidade de IDs enviados ao Redis por comando SADD durante o upload
+const bigSegmentBatchSize = 1000
+
+// Nomes aceitos para big segments (viram parte das chaves do Redis)
+var bigSegmentNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// bigSegmentMemberScript diferencia um big segment inexistente de um ID que
+// não é membro. KEYS: current, members. ARGV: chave do contexto.
+// Retorna -1 se o big segment não existir, 1 se o ID for membro e 0 caso contrário.
+var bigSegmentMemberScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return -1
+end
+return redis.call('SISMEMBER', KEYS[2], ARGV[1])
+`)
+
+// bigSegmentSwapScript ativa a versão do upload só se ela for mais nova que a
+// ativa (compare-and-set). Assim, se dois uploads se sobrepõem e o mais antigo
+// termina por último, ele é descartado em vez de voltar a versão.
+// KEYS: current, members, set da versão. ARGV: versão.
+// Retorna 1 se a versão foi ativada e 0 se já havia uma mais nova.
+var bigSegmentSwapScript = redis.NewScript(`
+local current = tonumber(redis.call('GET', KEYS[1]) or '0')
+if tonumber(ARGV[1]) <= current then
+	redis.call('UNLINK', KEYS[3])
+	return 0
+end
+redis.call('UNLINK', KEYS[2])
+redis.call('RENAME', KEYS[3], KEYS[2])
+redis.call('SET', KEYS[1], ARGV[1])
+return 1
+`)
+
+// bigSegmentKey monta as chaves de um big segment (ver o formato acima)
+func bigSegmentKey(environment, name, suffix string) string {
+	return fmt.Sprintf("big_segment:{%s:%s}:%s", environment, name, suffix)
+}
+
+func bigSegmentSeqKey(environment, name string) string {
+	return bigSegmentKey(environment, name, "seq")
+}
+
+func bigSegmentCurrentKey(environment, name string) string {
+	return bigSegmentKey(environment, name, "current")
+}
+
+func bigSegmentMembersKey(environment, name string) string {
+	return bigSegmentKey(environment, name, "members")
+}
+
+func bigSegmentSetKey(environment, name string, version int64) string {
+	return bigSegmentKey(environment, name, fmt.Sprintf("v%d", version))
+}
+
+// inBigSegment verifica se a chave do contexto está na versão ativa do big
+// segment (do mesmo ambiente da flag)
+func (e *evaluation) inBigSegment(name string) (bool, error) {
+	environment := e.evalCtx.Environment
+	keys := []string{bigSegmentCurrentKey(environment, name), bigSegmentMembersKey(environment, name)}
+	res, err := bigSegmentMemberScript.Run(ctx, e.app.RedisClient, keys, e.evalCtx.Key).Int()
+	if err != nil {
+		return false, &RuleError{Kind: ErrorServiceUnavailable, Msg: fmt.Sprintf("erro ao consultar big segment '%s': %v", name, err)}
+	}
+	if res < 0 {
+		return false, &RuleError{Kind: ErrorSegmentNotFound, Msg: fmt.Sprintf("big segment '%s' não encontrado", name)}
+	}
+	return res == 1, nil
+}
+
+// BigSegmentInfo é a resposta dos endpoints administrativos de big segments
+type BigSegmentInfo struct {
+	Name        string `json:"name"`
+	Environment string `json:"environment"`
+	Version     int64  `json:"version"`
+	Size        int64  `json:"size"`
+}
+
+// bigSegmentHandler trata /admin/big-segments/<nome>:
+// GET mostra a versão ativa e POST faz o upload de uma nova versão, no
+// ambiente da requisição (X-Environment, como no /evaluate)
+func (a *App) bigSegmentHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	name := strings.TrimPrefix(r.URL.Path, "/admin/big-segments/")
+	if !bigSegmentNamePattern.MatchString(name) {
+		http.Error(w, `{"error": "Nome de big segment inválido (use letras, números, '_' e '-')"}`, http.StatusBadRequest)
+		return
+	}
+
+	environment, ok := a.requestEnvironment(w, r)
+	if !ok {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		a.getBigSegmentHandler(w, environment, name)
+	case http.MethodPost:
+		a.uploadBigSegmentHandler(w, r, environment, name)
+	default:
+		http.Error(w, `{"error": "Método não permitido"}`, http.StatusMethodNotAllowed)
+	}
+}
+
+// getBigSegmentHandler retorna a versão ativa e o tamanho do big segment
+func (a *App) getBigSegmentHandler(w http.ResponseWriter, environment, name string) {
+	version, err := a.RedisClient.Get(ctx, bigSegmentCurrentKey(environment, name)).Int64()
+	if err == redis.Nil {
+		http.Error(w, `{"error": "Big segment não encontrado"}`, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Erro ao buscar big segment '%s': %v", name, err)
+		http.Error(w, `{"error": "Erro ao acessar o Redis"}`, http.StatusBadGateway)
+		return
+	}
+
+	size, err := a.RedisClient.SCard(ctx, bigSegmentMembersKey(environment, name)).Result()
+	if err != nil {
+		log.Printf("Erro ao contar big segment '%s': %v", name, err)
+		http.Error(w, `{"error": "Erro ao acessar o Redis"}`, http.StatusBadGateway)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(BigSegmentInfo{Name: name, Environment: environment, Version: version, Size: size})
+}
+
+// uploadBigSegmentHandler lê o corpo da requisição em streaming (CSV ou um ID
+// por linha), grava os IDs em uma nova versão do set e só então a ativa.
+// Com Content-Type text/csv, usa a primeira coluna (?header=true ignora a 1ª linha).
+func (a *App) uploadBigSegmentHandler(w http.ResponseWriter, r *http.Request, environment, name string) {
+	// 1. Reserva uma nova versão
+	version, err := a.RedisClient.Incr(ctx, bigSegmentSeqKey(environment, name)).Result()
+	if err != nil {
+		log.Printf("Erro ao gerar versão do big segment '%s': %v", name, err)
+		http.Error(w, `{"error": "Erro ao acessar o Redis"}`, http.StatusBadGateway)
+		return
+	}
+	setKey := bigSegmentSetKey(environment, name, version)
+
+	// 2. Lê os IDs em lotes e grava no set da nova versão
+	next := newlineReader(r.Body)
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "text/csv") {
+		next = csvReader(r.Body, r.URL.Query().Get("header") == "true")
+	}
+
+	var size int64
+	batch := make([]interface{}, 0, bigSegmentBatchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		added, err := a.RedisClient.SAdd(ctx, setKey, batch...).Result()
+		size += added
+		batch = batch[:0]
+		return err
+	}
+
+	// Em caso de erro, descarta a versão parcial; a versão ativa continua intacta
+	discard := func(err error, status int, msg string) {
+		log.Printf("Erro no upload do big segment '%s': %v", name, err)
+		a.RedisClient.Unlink(ctx, setKey)
+		http.Error(w, msg, status)
+	}
+
+	for {
+		id, err := next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			discard(err, http.StatusBadRequest, fmt.Sprintf(`{"error": "Corpo inválido: %s"}`, jsonEscape(err.Error())))
+			return
+		}
+		if id == "" {
+			continue
+		}
+		batch = append(batch, id)
+		if len(batch) == bigSegmentBatchSize {
+			if err := flush(); err != nil {
+				discard(err, http.StatusBadGateway, `{"error": "Erro ao acessar o Redis"}`)
+				return
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		discard(err, http.StatusBadGateway, `{"error": "Erro ao acessar o Redis"}`)
+		return
+	}
+	if size == 0 {
+		http.Error(w, `{"error": "Nenhum ID encontrado no corpo da requisição"}`, http.StatusBadRequest)
+		return
+	}
+
+	// 3. Ativa a nova versão atomicamente (removendo a anterior), desde que
+	// nenhum upload mais novo tenha terminado antes deste
+	keys := []string{bigSegmentCurrentKey(environment, name), bigSegmentMembersKey(environment, name), setKey}
+	swapped, err := bigSegmentSwapScript.Run(ctx, a.RedisClient, keys, version).Int()
+	if err != nil {
+		discard(err, http.StatusBadGateway, `{"error": "Erro ao acessar o Redis"}`)
+		return
+	}
+	if swapped == 0 {
+		log.Printf("Upload da versão %d do big segment '%s' (%s) descartado: já existe uma versão mais nova", version, name, environment)
+		http.Error(w, `{"error": "Um upload mais novo deste big segment já foi ativado"}`, http.StatusConflict)
+		return
+	}
+
+	log.Printf("Big segment '%s' (%s) atualizado para a versão %d (%d IDs)", name, environment, version, size)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(BigSegmentInfo{Name: name, Environment: environment, Version: version, Size: size})
+}
+
+// newlineReader retorna uma função que lê um ID por linha
+func newlineReader(body io.Reader) func() (string, error) {
+	scanner := bufio.NewScanner(body)
+	return func() (string, error) {
+		if !scanner.Scan() {
+			if err := scanner.Err(); err != nil {
+				return "", err
+			}
+			return "", io.EOF
+		}
+		return strings.TrimSpace(scanner.Text()), nil
+	}
+}
+
+// csvReader retorna uma função que lê a primeira coluna de cada linha do CSV
+func csvReader(body io.Reader, skipHeader bool) func() (string, error) {
+	reader := csv.NewReader(body)
+	reader.FieldsPerRecord = -1 // linhas podem ter quantidades diferentes de colunas
+	reader.ReuseRecord = true
+	return func() (string, error) {
+		record, err := reader.Read()
+		if err != nil {
+			return "", err
+		}
+		if skipHeader {
+			skipHeader = false
+			return "", nil
+		}
+		return strings.TrimSpace(record[0]), nil
+	}
+}
+
+// jsonEscape escapa uma mensagem para ser embutida em uma string JSON
+func jsonEscape(s string) string {
+	b, _ := json.Marshal(s)
+	return string(b[1 : len(b)-1])
+}
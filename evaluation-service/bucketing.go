@@ -0,0 +1,49 @@
+package main
+
+import (
+	"crypto/sha1" // Usado para hash determinístico
+	"encoding/binary"
+)
+
+const (
+	// BucketScale é o tamanho do espaço de buckets (0-99999).
+	// Permite rollouts de até 0,001% dos usuários.
+	BucketScale = 100000
+
+	// HashVersionLegacy é o "dado" de 100 faces original (val % 100).
+	// Regras sem 'hash_version' usam esta versão, mantendo as atribuições antigas.
+	HashVersionLegacy = 1
+
+	// HashVersionHighRes usa os 100.000 buckets (val % 100000).
+	// O targeting-service grava esta versão em todas as regras novas.
+	HashVersionHighRes = 2
+)
+
+// getBucket retorna o bucket do usuário na escala 0-99999,
+// de acordo com a versão do hash da regra
+func getBucket(input string, hashVersion int) int {
+	if hashVersion == HashVersionHighRes {
+		return int(hashInput(input) % BucketScale)
+	}
+	// v1: o bucket antigo (0-99) multiplicado para a nova escala.
+	// Como 'bucket < porcentagem' equivale a 'bucket*1000 < porcentagem*1000',
+	// as flags antigas continuam com exatamente os mesmos usuários.
+	return getDeterministicBucket(input) * (BucketScale / 100)
+}
+
+// getDeterministicBucket gera um "dado" de 100 faces (0-99)
+// que é sempre o mesmo para a mesma string de entrada.
+func getDeterministicBucket(input string) int {
+	// Retorna o módulo 100
+	return int(hashInput(input) % 100)
+}
+
+// hashInput usa SHA1 (rápido) e pega os primeiros 4 bytes como um uint32
+func hashInput(input string) uint32 {
+	hasher := sha1.New()
+	hasher.Write([]byte(input))
+	hash := hasher.Sum(nil)
+
+	// Converte 4 bytes para um uint32
+	return binary.BigEndian.Uint32(hash[:4])
+}
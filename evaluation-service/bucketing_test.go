@@ -0,0 +1,77 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"testing"
+)
+
+// baselineBucket é o getDeterministicBucket original (antes do hash_version),
+// copiado aqui para garantir que as flags antigas mantêm os mesmos usuários
+func baselineBucket(input string) int {
+	hasher := sha1.New()
+	hasher.Write([]byte(input))
+	hash := hasher.Sum(nil)
+	val := binary.BigEndian.Uint32(hash[:4])
+	return int(val % 100)
+}
+
+func TestGetBucketLegacyMatchesBaseline(t *testing.T) {
+	for i := 0; i < 10000; i++ {
+		input := fmt.Sprintf("user-%dcheckout-flow", i)
+		want := baselineBucket(input) * (BucketScale / 100)
+		if got := getBucket(input, HashVersionLegacy); got != want {
+			t.Fatalf("getBucket(%q, 1) = %d, esperado %d", input, got, want)
+		}
+	}
+}
+
+func TestGetBucketHighResRange(t *testing.T) {
+	for i := 0; i < 10000; i++ {
+		got := getBucket(fmt.Sprintf("user-%d", i), HashVersionHighRes)
+		if got < 0 || got >= BucketScale {
+			t.Fatalf("bucket %d fora de 0-%d", got, BucketScale-1)
+		}
+	}
+}
+
+// Uma regra PERCENTAGE sem hash_version (v1) libera exatamente os mesmos
+// usuários que o avaliador original: bucket(user + flag) < porcentagem
+func TestLegacyPercentageRuleMatchesBaseline(t *testing.T) {
+	tests := []struct {
+		name       string
+		percentage float64
+	}{
+		{"zero", 0},
+		{"um por cento", 1},
+		{"dez por cento", 10},
+		{"fracionária", 33.5},
+		{"metade", 50},
+		{"quase tudo", 99},
+		{"tudo", 100},
+	}
+
+	app := &App{}
+	flag := &Flag{Name: "checkout-flow", IsEnabled: true}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var rule TargetingRule
+			raw := fmt.Sprintf(`{"is_enabled": true, "rules": {"type": "PERCENTAGE", "value": %v}}`, tt.percentage)
+			if err := json.Unmarshal([]byte(raw), &rule); err != nil {
+				t.Fatal(err)
+			}
+			info := &CombinedFlagInfo{Flag: flag, Rule: &rule}
+
+			for i := 0; i < 2000; i++ {
+				key := fmt.Sprintf("user-%d", i)
+				want := float64(baselineBucket(key+flag.Name)) < tt.percentage
+				got := app.runEvaluationLogic(info, &EvaluationContext{Key: key})
+				if got.Result != want {
+					t.Fatalf("%s: resultado %v, esperado %v (bucket %d)", key, got.Result, want, baselineBucket(key+flag.Name))
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+)
+
+// flagIndexCacheKey é a chave do cache com a lista de nomes de todas as
+// flags de um ambiente (usada pelo /evaluate/all)
+func flagIndexCacheKey(environment string) string {
+	return fmt.Sprintf("flag_index:%s", environment)
+}
+
+// flagCacheKey é a chave do Redis com o CombinedFlagInfo de uma flag.
+// O ambiente faz parte da chave, para staging e prod nunca dividirem o cache.
+func flagCacheKey(environment, flagName string) string {
+	return fmt.Sprintf("flag_info:%s:%s", environment, flagName)
+}
+
+// getCombinedFlagInfos busca os dados de várias flags de uma só vez.
+// Sem nomes, busca TODAS as flags. Usa um único MGET no Redis e, se faltar
+// alguma flag no cache, faz só 2 chamadas (uma por serviço) para buscar as
+// listas completas, em vez de um fetchFromServices por flag.
+// Flags inexistentes simplesmente não aparecem no mapa retornado.
+func (a *App) getCombinedFlagInfos(environment string, flagNames []string) (map[string]*CombinedFlagInfo, error) {
+	// 1. Sem nomes: usa o índice de flags do cache (ou busca tudo)
+	if len(flagNames) == 0 {
+		val, err := a.RedisClient.Get(ctx, flagIndexCacheKey(environment)).Result()
+		if err != nil || json.Unmarshal([]byte(val), &flagNames) != nil {
+			log.Printf("Cache MISS para o índice de flags (%s)", environment)
+			return a.fetchAndCacheAll(environment)
+		}
+	}
+	if len(flagNames) == 0 {
+		return map[string]*CombinedFlagInfo{}, nil
+	}
+
+	// 2. Tentar buscar todas do Cache (Redis) com um único MGET.
+	// O índice de flags vai junto, no fim, para sabermos quais nomes não existem.
+	keys := make([]string, len(flagNames)+1)
+	for i, name := range flagNames {
+		keys[i] = flagCacheKey(environment, name)
+	}
+	keys[len(flagNames)] = flagIndexCacheKey(environment)
+
+	vals, err := a.RedisClient.MGet(ctx, keys...).Result()
+	if err != nil {
+		log.Printf("Erro no MGET do cache: %v", err)
+		vals = make([]interface{}, len(keys))
+	}
+
+	var index map[string]bool
+	if str, ok := vals[len(flagNames)].(string); ok {
+		var names []string
+		if json.Unmarshal([]byte(str), &names) == nil {
+			index = make(map[string]bool, len(names))
+			for _, name := range names {
+				index[name] = true
+			}
+		}
+	}
+
+	infos := make(map[string]*CombinedFlagInfo, len(flagNames))
+	missing := 0
+	for i, name := range flagNames {
+		if str, ok := vals[i].(string); ok {
+			if info, err := getCompiledFlag(keys[i], str); err == nil {
+				infos[name] = info
+				continue
+			}
+		}
+		// Fora do índice = flag inexistente, não adianta buscar nos serviços
+		if index != nil && !index[name] {
+			continue
+		}
+		missing++
+	}
+	log.Printf("Cache em lote: %d HIT, %d MISS", len(infos), missing)
+	if missing == 0 {
+		return infos, nil
+	}
+
+	// 3. Cache MISS de alguma flag - busca as listas completas dos serviços
+	all, err := a.fetchAndCacheAll(environment)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range flagNames {
+		if _, ok := infos[name]; !ok {
+			if info, ok := all[name]; ok {
+				infos[name] = info
+			}
+		}
+	}
+	return infos, nil
+}
+
+// fetchAndCacheAll busca todas as flags e regras do ambiente e salva cada uma no cache
+func (a *App) fetchAndCacheAll(environment string) (map[string]*CombinedFlagInfo, error) {
+	all, err := a.fetchAllFromServices(environment)
+	if err != nil {
+		return nil, err
+	}
+
+	// Salva tudo no Cache com um único pipeline
+	names := make([]string, 0, len(all))
+	pipe := a.RedisClient.Pipeline()
+	for name, info := range all {
+		names = append(names, name)
+		if jsonData, err := json.Marshal(info); err == nil {
+			pipe.Set(ctx, flagCacheKey(environment, name), jsonData, CACHE_TTL)
+			storeCompiledFlag(flagCacheKey(environment, name), string(jsonData), info)
+		}
+	}
+	if jsonData, err := json.Marshal(names); err == nil {
+		pipe.Set(ctx, flagIndexCacheKey(environment), jsonData, CACHE_TTL)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("Erro ao salvar flags no cache: %v", err)
+	}
+
+	return all, nil
+}
+
+// fetchAllFromServices busca TODAS as flags, regras e overrides do ambiente concorrentemente (3 chamadas)
+func (a *App) fetchAllFromServices(environment string) (map[string]*CombinedFlagInfo, error) {
+	var wg sync.WaitGroup
+	wg.Add(3)
+
+	var flags []Flag
+	var rules []TargetingRule
+	var overrides []Override
+	var flagErr, ruleErr, overrideErr error
+
+	go func() {
+		defer wg.Done()
+		flagErr = a.fetchList(fmt.Sprintf("%s/flags?%s", a.FlagServiceURL, environmentQuery(environment)), "flag-service", &flags)
+	}()
+
+	go func() {
+		defer wg.Done()
+		ruleErr = a.fetchList(fmt.Sprintf("%s/rules?%s", a.TargetingServiceURL, environmentQuery(environment)), "targeting-service", &rules)
+	}()
+
+	go func() {
+		defer wg.Done()
+		overrideErr = a.fetchList(fmt.Sprintf("%s/overrides?%s", a.TargetingServiceURL, environmentQuery(environment)), "targeting-service", &overrides)
+	}()
+
+	wg.Wait()
+
+	if flagErr != nil {
+		return nil, flagErr
+	}
+	// Aqui a falha na lista de regras É fatal: sem ela, todas as flags
+	// ligadas seriam liberadas para 100% dos usuários (e ficariam no cache)
+	if ruleErr != nil {
+		return nil, ruleErr
+	}
+
+	// Sem os overrides, as flags são avaliadas normalmente pelas regras
+	if overrideErr != nil {
+		log.Printf("Aviso: Erro ao buscar overrides: %v", overrideErr)
+	}
+
+	rulesByFlag := make(map[string]*TargetingRule, len(rules))
+	for i := range rules {
+		rulesByFlag[rules[i].FlagName] = &rules[i]
+	}
+	overridesByFlag := make(map[string][]Override)
+	for _, override := range overrides {
+		overridesByFlag[override.FlagName] = append(overridesByFlag[override.FlagName], override)
+	}
+
+	all := make(map[string]*CombinedFlagInfo, len(flags))
+	for i := range flags {
+		all[flags[i].Name] = &CombinedFlagInfo{
+			Flag:      &flags[i],
+			Rule:      rulesByFlag[flags[i].Name],
+			Overrides: overridesByFlag[flags[i].Name],
+		}
+	}
+	return all, nil
+}
+
+// fetchList faz um GET autenticado em um endpoint de listagem (função helper)
+func (a *App) fetchList(url, serviceName string, target interface{}) error {
+	apiKey := os.Getenv("SERVICE_API_KEY")
+	req, _ := http.NewRequest("GET", url, nil)
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+
+	resp, err := a.HttpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("erro ao chamar %s: %w", serviceName, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s retornou status %d", serviceName, resp.StatusCode)
+	}
+
+	body, _ := ioutil.ReadAll(resp.Body)
+	if err := json.Unmarshal(body, target); err != nil {
+		return fmt.Errorf("erro ao desserializar resposta do %s: %w", serviceName, err)
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/google/cel-go/cel"
+)
+
+// Regras CEL (Common Expression Language, https://cel.dev): a condição é uma
+// expressão booleana sobre o contexto de avaliação, ex:
+// {"type": "CEL", "value": "attributes.plan == 'pro' && attributes.age >= 18"}
+//
+// Variáveis disponíveis na expressão:
+//   key          string              chave do contexto
+//   attributes   map(string, dyn)    atributos do contexto
+//   ip           string              IP do cliente (ver ip.go)
+//   environment  string              ambiente da avaliação
+//   flag         string              nome da flag avaliada
+//   now          timestamp           momento da avaliação
+
+const (
+	// Custo máximo de uma avaliação (evita expressões que travem o serviço)
+	celCostLimit = 100000
+	// Máximo de programas compilados em memória
+	celCacheSize = 10000
+)
+
+var (
+	celEnvOnce sync.Once
+	celEnv     *cel.Env
+	celEnvErr  error
+
+	// Programas compilados, pela expressão. Uma nova versão da regra (outra
+	// expressão) é compilada na primeira avaliação; as seguintes reaproveitam.
+	celProgramsMu sync.RWMutex
+	celPrograms   = map[string]cel.Program{}
+)
+
+// getCELEnv cria (uma única vez) o ambiente CEL com as variáveis do contexto
+func getCELEnv() (*cel.Env, error) {
+	celEnvOnce.Do(func() {
+		celEnv, celEnvErr = cel.NewEnv(
+			cel.Variable("key", cel.StringType),
+			cel.Variable("attributes", cel.MapType(cel.StringType, cel.DynType)),
+			cel.Variable("ip", cel.StringType),
+			cel.Variable("environment", cel.StringType),
+			cel.Variable("flag", cel.StringType),
+			cel.Variable("now", cel.TimestampType),
+		)
+	})
+	return celEnv, celEnvErr
+}
+
+// compileCEL compila uma expressão CEL (ou a busca no cache). Erros de sintaxe,
+// de tipo ou uma expressão que não retorna bool são erros de configuração da regra.
+func compileCEL(expression string) (cel.Program, error) {
+	celProgramsMu.RLock()
+	program, ok := celPrograms[expression]
+	celProgramsMu.RUnlock()
+	if ok {
+		return program, nil
+	}
+
+	env, err := getCELEnv()
+	if err != nil {
+		return nil, fmt.Errorf("erro ao criar o ambiente CEL: %w", err)
+	}
+	ast, issues := env.Compile(expression)
+	if issues != nil && issues.Err() != nil {
+		return nil, newRuleError("expressão CEL inválida: %v", issues.Err())
+	}
+	if !ast.OutputType().IsExactType(cel.BoolType) && !ast.OutputType().IsExactType(cel.DynType) {
+		return nil, newRuleError("a expressão CEL deve retornar bool (retorna %s)", ast.OutputType())
+	}
+	program, err = env.Program(ast, cel.CostLimit(celCostLimit))
+	if err != nil {
+		return nil, newRuleError("expressão CEL inválida: %v", err)
+	}
+
+	celProgramsMu.Lock()
+	// Cache cheio (muitas expressões diferentes): recomeça do zero
+	if len(celPrograms) >= celCacheSize {
+		celPrograms = map[string]cel.Program{}
+	}
+	celPrograms[expression] = program
+	celProgramsMu.Unlock()
+	return program, nil
+}
+
+// validateCELRule compila a expressão da regra (erros aparecem ao salvar)
+func validateCELRule(rule Rule) error {
+	expression, ok := rule.Value.(string)
+	if !ok || strings.TrimSpace(expression) == "" {
+		return newRuleError("valor da regra CEL deve ser uma expressão (string)")
+	}
+	_, err := compileCEL(expression)
+	return err
+}
+
+// ruleProgram devolve o programa da regra: o já compilado (ver compile.go)
+// ou o do cache de programas
+func ruleProgram(rule Rule) (cel.Program, error) {
+	if rule.compiled != nil && rule.compiled.program != nil {
+		return rule.compiled.program, nil
+	}
+	expression, ok := rule.Value.(string)
+	if !ok || strings.TrimSpace(expression) == "" {
+		return nil, newRuleError("valor da regra CEL deve ser uma expressão (string)")
+	}
+	return compileCEL(expression)
+}
+
+// matchCEL avalia uma regra CEL contra o contexto
+func (e *evaluation) matchCEL(rule Rule) (bool, error) {
+	program, err := ruleProgram(rule)
+	if err != nil {
+		return false, err
+	}
+
+	attributes := e.evalCtx.Attributes
+	if attributes == nil {
+		attributes = map[string]interface{}{}
+	}
+	out, _, err := program.Eval(map[string]interface{}{
+		"key":         e.evalCtx.Key,
+		"attributes":  attributes,
+		"ip":          e.evalCtx.IP,
+		"environment": e.evalCtx.Environment,
+		"flag":        e.flag.Name,
+		"now":         e.now,
+	})
+	if err != nil {
+		// Atributo ausente nunca casa (como nas cláusulas do ATTRIBUTE).
+		// Use has(attributes.x) para tratar a ausência explicitamente.
+		if strings.HasPrefix(err.Error(), "no such key") {
+			return false, nil
+		}
+		return false, newRuleError("erro ao avaliar a expressão CEL: %v", err)
+	}
+
+	result, ok := out.Value().(bool)
+	if !ok {
+		return false, newRuleError("a expressão CEL retornou %v, e não um bool", out.Value())
+	}
+	return result, nil
+}
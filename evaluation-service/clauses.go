@@ -0,0 +1,195 @@
+package main
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// matchClauses retorna true se TODAS as cláusulas forem atendidas (AND).
+// 'now' é o relógio da avaliação, usado pelos operadores de data (ver datetime.go).
+func matchClauses(clauses []Clause, evalCtx *EvaluationContext, now time.Time) (bool, error) {
+	for _, clause := range clauses {
+		ok, err := matchClause(clause, evalCtx, now)
+		if err != nil {
+			return false, err
+		}
+		if !ok {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// matchClause avalia uma única cláusula contra o contexto
+func matchClause(clause Clause, evalCtx *EvaluationContext, now time.Time) (bool, error) {
+	attrValue, found := evalCtx.attribute(clause.Attribute)
+	if !found {
+		// Atributo ausente nunca casa, mesmo com 'negate'
+		return false, nil
+	}
+
+	// Se o atributo for uma lista (ex: "groups": ["staff", "beta"]),
+	// basta um dos elementos casar
+	candidates := []interface{}{attrValue}
+	if list, ok := attrValue.([]interface{}); ok {
+		candidates = list
+	}
+
+	matched := false
+	for _, candidate := range candidates {
+		ok, err := matchOperator(clause.Operator, candidate, clause.Values, clause.regexps, now)
+		if err != nil {
+			return false, err
+		}
+		if ok {
+			matched = true
+			break
+		}
+	}
+
+	if clause.Negate {
+		return !matched, nil
+	}
+	return matched, nil
+}
+
+// matchOperator compara o valor do atributo com os valores da cláusula.
+// A cláusula é atendida se QUALQUER um dos valores casar (OR).
+// 'regexps' são as regex já compiladas de cada valor (nil = compila na hora).
+func matchOperator(operator string, attrValue interface{}, values []interface{}, regexps []*regexp.Regexp, now time.Time) (bool, error) {
+	for i, value := range values {
+		var ok bool
+		var err error
+		switch operator {
+		case "equals", "in":
+			ok = valuesEqual(attrValue, value)
+
+		case "contains":
+			ok = compareStrings(attrValue, value, strings.Contains)
+
+		case "startsWith":
+			ok = compareStrings(attrValue, value, strings.HasPrefix)
+
+		case "endsWith":
+			ok = compareStrings(attrValue, value, strings.HasSuffix)
+
+		case "greaterThan":
+			ok = compareNumbers(attrValue, value, func(a, b float64) bool { return a > b })
+
+		case "greaterThanOrEqual":
+			ok = compareNumbers(attrValue, value, func(a, b float64) bool { return a >= b })
+
+		case "lessThan":
+			ok = compareNumbers(attrValue, value, func(a, b float64) bool { return a < b })
+
+		case "lessThanOrEqual":
+			ok = compareNumbers(attrValue, value, func(a, b float64) bool { return a <= b })
+
+		case "regex":
+			pattern, isString := value.(string)
+			attrString, attrIsString := attrValue.(string)
+			if !isString || !attrIsString {
+				continue
+			}
+			var re *regexp.Regexp
+			if i < len(regexps) && regexps[i] != nil {
+				re = regexps[i]
+			} else if re, err = regexp.Compile(pattern); err != nil {
+				return false, newRuleError("regex inválida '%s': %v", pattern, err)
+			}
+			ok = re.MatchString(attrString)
+
+		// Operadores de versão semântica (ver semver.go): "4.9" < "4.12"
+		case "semverEq":
+			ok, err = compareSemverValues(attrValue, value, func(c int) bool { return c == 0 })
+
+		case "semverGt":
+			ok, err = compareSemverValues(attrValue, value, func(c int) bool { return c > 0 })
+
+		case "semverGte":
+			ok, err = compareSemverValues(attrValue, value, func(c int) bool { return c >= 0 })
+
+		case "semverLt":
+			ok, err = compareSemverValues(attrValue, value, func(c int) bool { return c < 0 })
+
+		case "semverLte":
+			ok, err = compareSemverValues(attrValue, value, func(c int) bool { return c <= 0 })
+
+		case "semverRange":
+			ok, err = matchSemverRange(attrValue, value)
+
+		case "cidr":
+			// IPv4 ou IPv6 dentro da rede (ver ip.go), ex: "10.0.0.0/8", "2001:db8::/32"
+			ok, err = matchCIDR(attrValue, value)
+
+		// Operadores de data (ver datetime.go): RFC 3339 ou timestamp Unix
+		case "before":
+			ok, err = compareTimeValues(attrValue, value, func(attr, want time.Time) bool { return attr.Before(want) })
+
+		case "after":
+			ok, err = compareTimeValues(attrValue, value, func(attr, want time.Time) bool { return attr.After(want) })
+
+		case "within":
+			// Nos últimos 'value' (ex: "30d") até agora, pelo relógio da avaliação
+			ok, err = matchWithin(attrValue, value, now)
+
+		case "olderThan":
+			// Antes dos últimos 'value' (ex: "30d"): exige uma data válida no passado
+			ok, err = matchOlderThan(attrValue, value, now)
+
+		default:
+			return false, newRuleError("operador desconhecido '%s'", operator)
+		}
+
+		if err != nil {
+			return false, err
+		}
+		if ok {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// valuesEqual compara strings e booleanos pelo valor exato e números como números
+func valuesEqual(a, b interface{}) bool {
+	switch va := a.(type) {
+	case string:
+		vb, ok := b.(string)
+		return ok && va == vb
+	case bool:
+		vb, ok := b.(bool)
+		return ok && va == vb
+	}
+	return compareNumbers(a, b, func(a, b float64) bool { return a == b })
+}
+
+// compareStrings aplica 'fn' apenas se ambos os valores forem strings
+func compareStrings(a, b interface{}, fn func(s, substr string) bool) bool {
+	strA, okA := a.(string)
+	strB, okB := b.(string)
+	return okA && okB && fn(strA, strB)
+}
+
+// compareNumbers aplica 'fn' apenas se ambos os valores forem numéricos
+func compareNumbers(a, b interface{}, fn func(a, b float64) bool) bool {
+	numA, okA := toFloat(a)
+	numB, okB := toFloat(b)
+	return okA && okB && fn(numA, numB)
+}
+
+// toFloat converte números do JSON (float64) e strings numéricas para float64
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case int:
+		return float64(n), true
+	case string:
+		f, err := strconv.ParseFloat(n, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
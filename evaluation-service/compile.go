@@ -0,0 +1,208 @@
+package main
+
+import (
+	"encoding/json"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/google/cel-go/cel"
+)
+
+// Máximo de flags compiladas em memória (somando todos os ambientes)
+const compiledFlagCacheSize = 10000
+
+// compiledFlag é uma flag já desserializada e compilada, junto com o payload
+// do Redis de onde ela veio. O payload funciona como a versão: enquanto o
+// Redis devolver exatamente o mesmo conteúdo, a flag compilada é reaproveitada
+// e o caminho quente não faz nenhum json.Unmarshal.
+type compiledFlag struct {
+	payload string
+	info    *CombinedFlagInfo
+}
+
+var (
+	compiledFlagsMu sync.RWMutex
+	compiledFlags   = map[string]*compiledFlag{}
+)
+
+// compiledSegment é o mesmo esquema do compiledFlag para os segmentos
+// (regras SEGMENT), que também são avaliados no caminho quente
+type compiledSegment struct {
+	payload string
+	segment *Segment
+}
+
+var (
+	compiledSegmentsMu sync.RWMutex
+	compiledSegments   = map[string]*compiledSegment{}
+)
+
+// compiledRule é a forma tipada de uma Rule, montada uma única vez quando a
+// flag entra no cache em memória: valores já convertidos, datas já
+// interpretadas e expressões já compiladas. Só é lida depois de montada.
+type compiledRule struct {
+	ruleType RuleType // entrada do registro (evita a busca a cada avaliação)
+
+	percentage    float64 // PERCENTAGE
+	hasPercentage bool
+
+	start, end  time.Time // TIME_WINDOW e RAMP
+	hasSchedule bool
+
+	program cel.Program // CEL
+}
+
+// getCompiledFlag devolve a flag compilada para o payload do Redis, compilando
+// (e guardando) uma nova versão se o payload mudou. As flags devolvidas são
+// compartilhadas entre as requisições e NÃO podem ser alteradas.
+func getCompiledFlag(cacheKey, payload string) (*CombinedFlagInfo, error) {
+	compiledFlagsMu.RLock()
+	entry, ok := compiledFlags[cacheKey]
+	compiledFlagsMu.RUnlock()
+	if ok && entry.payload == payload {
+		return entry.info, nil
+	}
+
+	var info CombinedFlagInfo
+	if err := json.Unmarshal([]byte(payload), &info); err != nil {
+		return nil, err
+	}
+	storeCompiledFlag(cacheKey, payload, &info)
+	return &info, nil
+}
+
+// storeCompiledFlag compila a flag e a guarda em memória com o seu payload
+// (usado também logo depois de salvar a flag no Redis, para o próximo HIT já
+// encontrá-la compilada)
+func storeCompiledFlag(cacheKey, payload string, info *CombinedFlagInfo) {
+	compileFlagInfo(info)
+
+	compiledFlagsMu.Lock()
+	// Cache cheio (muitas flags/ambientes): descarta uma única flag qualquer
+	// (a ordem de iteração do map é aleatória), para que as outras continuem
+	// compiladas e disponíveis para o staleCompiledFlag
+	if _, exists := compiledFlags[cacheKey]; !exists && len(compiledFlags) >= compiledFlagCacheSize {
+		for key := range compiledFlags {
+			delete(compiledFlags, key)
+			break
+		}
+	}
+	compiledFlags[cacheKey] = &compiledFlag{payload: payload, info: info}
+	compiledFlagsMu.Unlock()
+}
+
+// getCompiledSegment devolve o segmento compilado para o payload do Redis
+// (mesmo esquema do getCompiledFlag)
+func getCompiledSegment(cacheKey, payload string) (*Segment, error) {
+	compiledSegmentsMu.RLock()
+	entry, ok := compiledSegments[cacheKey]
+	compiledSegmentsMu.RUnlock()
+	if ok && entry.payload == payload {
+		return entry.segment, nil
+	}
+
+	var segment Segment
+	if err := json.Unmarshal([]byte(payload), &segment); err != nil {
+		return nil, err
+	}
+	storeCompiledSegment(cacheKey, payload, &segment)
+	return &segment, nil
+}
+
+// storeCompiledSegment compila as regras do segmento e o guarda em memória
+func storeCompiledSegment(cacheKey, payload string, segment *Segment) {
+	for i := range segment.Rules {
+		compileRule(&segment.Rules[i])
+	}
+
+	compiledSegmentsMu.Lock()
+	if _, exists := compiledSegments[cacheKey]; !exists && len(compiledSegments) >= compiledFlagCacheSize {
+		for key := range compiledSegments {
+			delete(compiledSegments, key)
+			break
+		}
+	}
+	compiledSegments[cacheKey] = &compiledSegment{payload: payload, segment: segment}
+	compiledSegmentsMu.Unlock()
+}
+
+// compileFlagInfo compila todas as regras da flag
+func compileFlagInfo(info *CombinedFlagInfo) {
+	if info.Rule == nil {
+		return
+	}
+	compileRuleSet(&info.Rule.Rules)
+}
+
+// compileRuleSet compila as condições de todas as regras do conjunto
+func compileRuleSet(rs *RuleSet) {
+	for i := range rs.Rules {
+		compileRule(&rs.Rules[i].Condition)
+	}
+}
+
+// compileRule compila um nó da árvore (e os seus filhos) com o Compile do
+// tipo no registro. Uma regra que não compila fica sem a forma compilada e
+// segue pelo caminho normal, que reporta o erro na avaliação.
+func compileRule(rule *Rule) {
+	for i := range rule.Rules {
+		compileRule(&rule.Rules[i])
+	}
+
+	ruleType, ok := lookupRuleType(rule.Type)
+	if !ok {
+		return
+	}
+	compiled := &compiledRule{ruleType: ruleType}
+	if ruleType.Compile != nil && !ruleType.Compile(rule, compiled) {
+		return
+	}
+	rule.compiled = compiled
+}
+
+// --- Compile dos tipos embutidos ---
+
+func compilePercentageRule(rule *Rule, c *compiledRule) bool {
+	c.percentage, c.hasPercentage = rule.Value.(float64)
+	return true
+}
+
+func compileScheduleRule(rule *Rule, c *compiledRule) bool {
+	start, end, err := parseSchedule(*rule)
+	if err != nil {
+		return false
+	}
+	c.start, c.end, c.hasSchedule = start, end, true
+	return true
+}
+
+func compileCELRule(rule *Rule, c *compiledRule) bool {
+	expression, ok := rule.Value.(string)
+	if !ok {
+		return false
+	}
+	program, err := compileCEL(expression)
+	if err != nil {
+		return false
+	}
+	c.program = program
+	return true
+}
+
+// compileAttributeRule compila as regex das cláusulas (uma por valor)
+func compileAttributeRule(rule *Rule, c *compiledRule) bool {
+	for i := range rule.Clauses {
+		clause := &rule.Clauses[i]
+		if clause.Operator != "regex" {
+			continue
+		}
+		clause.regexps = make([]*regexp.Regexp, len(clause.Values))
+		for j, value := range clause.Values {
+			if pattern, ok := value.(string); ok {
+				clause.regexps[j], _ = regexp.Compile(pattern)
+			}
+		}
+	}
+	return true
+}
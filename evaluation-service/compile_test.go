@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+// Com o cache cheio, uma flag nova descarta uma única flag, e não todas
+func TestCompiledFlagCacheEvictsOneEntry(t *testing.T) {
+	compiledFlagsMu.Lock()
+	saved := compiledFlags
+	compiledFlags = map[string]*compiledFlag{}
+	compiledFlagsMu.Unlock()
+	t.Cleanup(func() {
+		compiledFlagsMu.Lock()
+		compiledFlags = saved
+		compiledFlagsMu.Unlock()
+	})
+
+	for i := 0; i < compiledFlagCacheSize; i++ {
+		storeCompiledFlag(fmt.Sprintf("flag_info:production:flag-%d", i), "{}", &CombinedFlagInfo{})
+	}
+
+	// Atualizar uma flag que já está no cache não descarta nenhuma outra
+	storeCompiledFlag("flag_info:production:flag-0", `{"v": 2}`, &CombinedFlagInfo{})
+	if len(compiledFlags) != compiledFlagCacheSize {
+		t.Fatalf("%d flags no cache após atualização, esperado %d", len(compiledFlags), compiledFlagCacheSize)
+	}
+
+	storeCompiledFlag("flag_info:production:nova", "{}", &CombinedFlagInfo{})
+	if len(compiledFlags) != compiledFlagCacheSize {
+		t.Errorf("%d flags no cache, esperado %d", len(compiledFlags), compiledFlagCacheSize)
+	}
+	if _, ok := compiledFlags["flag_info:production:nova"]; !ok {
+		t.Error("flag nova não ficou no cache")
+	}
+}
+
+func TestCompiledSegmentCacheEvictsOneEntry(t *testing.T) {
+	compiledSegmentsMu.Lock()
+	saved := compiledSegments
+	compiledSegments = map[string]*compiledSegment{}
+	compiledSegmentsMu.Unlock()
+	t.Cleanup(func() {
+		compiledSegmentsMu.Lock()
+		compiledSegments = saved
+		compiledSegmentsMu.Unlock()
+	})
+
+	for i := 0; i < compiledFlagCacheSize; i++ {
+		storeCompiledSegment(fmt.Sprintf("segment_info:production:segment-%d", i), "{}", &Segment{})
+	}
+	storeCompiledSegment("segment_info:production:novo", "{}", &Segment{})
+	if len(compiledSegments) != compiledFlagCacheSize {
+		t.Errorf("%d segmentos no cache, esperado %d", len(compiledSegments), compiledFlagCacheSize)
+	}
+	if _, ok := compiledSegments["segment_info:production:novo"]; !ok {
+		t.Error("segmento novo não ficou no cache")
+	}
+}
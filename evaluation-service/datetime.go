@@ -0,0 +1,117 @@
+package main
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Timestamps Unix acima deste valor estão em milissegundos (em segundos,
+// ele só seria atingido no ano 33658)
+const unixMillisThreshold = 1e12
+
+// parseTimeValue interpreta uma data/hora de um atributo ou de uma cláusula:
+// string RFC 3339 ("2026-01-01T09:00:00-03:00"), data/hora sem offset (UTC,
+// ex: "2026-01-01") ou timestamp Unix em segundos ou milissegundos (número
+// ou string numérica)
+func parseTimeValue(value interface{}) (time.Time, bool) {
+	switch v := value.(type) {
+	case float64:
+		return unixTime(v)
+	case int:
+		return unixTime(float64(v))
+	case string:
+		s := strings.TrimSpace(v)
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return unixTime(f)
+		}
+		t, err := parseScheduleTime(s, time.UTC)
+		return t, err == nil && !t.IsZero()
+	}
+	return time.Time{}, false
+}
+
+// unixTime converte um timestamp Unix (segundos ou milissegundos)
+func unixTime(ts float64) (time.Time, bool) {
+	if math.IsNaN(ts) || math.IsInf(ts, 0) {
+		return time.Time{}, false
+	}
+	if math.Abs(ts) >= unixMillisThreshold {
+		return time.UnixMilli(int64(ts)).UTC(), true
+	}
+	sec, frac := math.Modf(ts)
+	return time.Unix(int64(sec), int64(frac*1e9)).UTC(), true
+}
+
+// compareTimeValues aplica 'fn' às datas do atributo e da cláusula.
+// Como nas versões, um atributo que não é uma data não casa, mas uma data
+// inválida na cláusula é erro de configuração da regra.
+func compareTimeValues(attrValue, value interface{}, fn func(attr, want time.Time) bool) (bool, error) {
+	want, ok := parseTimeValue(value)
+	if !ok {
+		return false, newRuleError("data/hora inválida na cláusula: %v", value)
+	}
+	got, ok := parseTimeValue(attrValue)
+	if !ok {
+		return false, nil
+	}
+	return fn(got, want), nil
+}
+
+// matchWithin verifica se a data do atributo está nos últimos 'value' (uma
+// duração, ex: "30d", "2w", "12h", "1h30m") até 'now', o relógio da avaliação
+func matchWithin(attrValue, value interface{}, now time.Time) (bool, error) {
+	return compareAge(attrValue, value, now, func(attr, since time.Time) bool {
+		return !attr.Before(since) && !attr.After(now)
+	})
+}
+
+// matchOlderThan verifica se a data do atributo é anterior aos últimos 'value'
+// (ex: "conta com mais de 30 dias"). Diferente de 'within' com 'negate', um
+// atributo que não é uma data (ou uma data no futuro) não casa.
+func matchOlderThan(attrValue, value interface{}, now time.Time) (bool, error) {
+	return compareAge(attrValue, value, now, func(attr, since time.Time) bool {
+		return attr.Before(since)
+	})
+}
+
+// compareAge aplica 'fn' à data do atributo e ao início do intervalo
+// (now - duração da cláusula). Uma duração inválida é erro de configuração.
+func compareAge(attrValue, value interface{}, now time.Time, fn func(attr, since time.Time) bool) (bool, error) {
+	str, ok := value.(string)
+	if !ok {
+		return false, newRuleError("duração inválida na cláusula: %v", value)
+	}
+	d, ok := parseDuration(str)
+	if !ok {
+		return false, newRuleError("duração inválida na cláusula: '%s'", str)
+	}
+
+	got, ok := parseTimeValue(attrValue)
+	if !ok {
+		return false, nil
+	}
+	return fn(got, now.Add(-d)), nil
+}
+
+// parseDuration aceita as durações do Go ("12h", "1h30m") e também dias
+// ("30d") e semanas ("2w"). Durações negativas são inválidas.
+func parseDuration(s string) (time.Duration, bool) {
+	s = strings.TrimSpace(s)
+	units := map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour}
+	for suffix, unit := range units {
+		if strings.HasSuffix(s, suffix) {
+			n, err := strconv.ParseFloat(strings.TrimSuffix(s, suffix), 64)
+			if err != nil || n < 0 {
+				return 0, false
+			}
+			return time.Duration(n * float64(unit)), true
+		}
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, false
+	}
+	return d, true
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+// Relógio fixo dos testes
+var testNow = time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+
+func daysAgo(n int) string {
+	return testNow.AddDate(0, 0, -n).Format(time.RFC3339)
+}
+
+func TestDateOperators(t *testing.T) {
+	tests := []struct {
+		name     string
+		operator string
+		attr     interface{}
+		value    interface{}
+		want     bool
+	}{
+		{"before: data anterior", "before", "2025-12-31", "2026-01-01", true},
+		{"before: mesma data", "before", "2026-01-01", "2026-01-01", false},
+		{"before: offset", "before", "2026-01-01T02:59:59Z", "2026-01-01T00:00:00-03:00", true},
+		{"before: unix segundos", "before", 1735689600.0, "2026-01-01", true},
+		{"before: unix milissegundos", "before", 1735689600000.0, "2026-01-01", true},
+		{"before: string numérica", "before", "1735689600", "2026-01-01", true},
+		{"before: atributo inválido", "before", "N/A", "2026-01-01", false},
+
+		{"after: data posterior", "after", "2026-01-01T03:00:01Z", "2026-01-01T00:00:00-03:00", true},
+		{"after: data anterior", "after", "2026-01-01", "2026-01-01T00:00:00-03:00", false},
+		{"after: atributo vazio", "after", "", "2026-01-01", false},
+
+		{"within: dentro", "within", daysAgo(10), "30d", true},
+		{"within: fora", "within", daysAgo(31), "30d", false},
+		{"within: no futuro", "within", "2027-01-01", "30d", false},
+		{"within: horas", "within", testNow.Add(-11 * time.Hour).Format(time.RFC3339), "12h", true},
+		{"within: semanas", "within", daysAgo(15), "2w", false},
+		{"within: atributo inválido", "within", "N/A", "30d", false},
+
+		{"olderThan: mais antiga", "olderThan", daysAgo(31), "30d", true},
+		{"olderThan: recente", "olderThan", daysAgo(10), "30d", false},
+		{"olderThan: no futuro", "olderThan", "2027-01-01", "30d", false},
+		{"olderThan: atributo inválido", "olderThan", "N/A", "30d", false},
+		{"olderThan: atributo vazio", "olderThan", "", "30d", false},
+		{"olderThan: atributo não é data", "olderThan", true, "30d", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := matchOperator(tt.operator, tt.attr, []interface{}{tt.value}, nil, testNow)
+			if err != nil {
+				t.Fatalf("erro inesperado: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("resultado %v, esperado %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// Datas e durações inválidas na cláusula são erro de configuração da regra
+func TestDateOperatorsMalformed(t *testing.T) {
+	tests := []struct {
+		operator string
+		value    interface{}
+	}{
+		{"before", "não é data"},
+		{"after", true},
+		{"within", "30x"},
+		{"within", "-1d"},
+		{"within", 30.0},
+		{"olderThan", ""},
+	}
+
+	for _, tt := range tests {
+		_, err := matchOperator(tt.operator, daysAgo(1), []interface{}{tt.value}, nil, testNow)
+		if err == nil || errorKind(err) != ErrorMalformedRule {
+			t.Errorf("%s %#v: %v, esperado MALFORMED_RULE", tt.operator, tt.value, err)
+		}
+	}
+}
+
+// O relógio da avaliação vem da App (Clock), e não do time.Now
+func TestDateOperatorsUseAppClock(t *testing.T) {
+	var rule TargetingRule
+	raw := `{"is_enabled": true, "rules": {"type": "ATTRIBUTE", "clauses": [{"attribute": "created_at", "operator": "olderThan", "values": ["30d"]}]}}`
+	if err := json.Unmarshal([]byte(raw), &rule); err != nil {
+		t.Fatal(err)
+	}
+	info := &CombinedFlagInfo{Flag: &Flag{Name: "loyalty-banner", IsEnabled: true}, Rule: &rule}
+	evalCtx := &EvaluationContext{Key: "user-1", Attributes: map[string]interface{}{"created_at": daysAgo(40)}}
+
+	tests := []struct {
+		name string
+		now  time.Time
+		want bool
+	}{
+		{"conta com 40 dias", testNow, true},
+		{"conta com 20 dias", testNow.AddDate(0, 0, -20), false},
+		{"conta ainda não criada", testNow.AddDate(0, 0, -50), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := tt.now
+			app := &App{Clock: func() time.Time { return now }}
+			if got := app.runEvaluationLogic(info, evalCtx); got.Result != tt.want {
+				t.Errorf("resultado %v (%s), esperado %v", got.Result, got.Reason.Kind, tt.want)
+			}
+		})
+	}
+}
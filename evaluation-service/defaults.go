@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// withFlagValues aplica os valores definidos na flag a uma decisão:
+//   - 'fallback_value' quando a avaliação falhou (motivo ERROR)
+//   - 'off_value' quando a flag está desligada para o usuário
+//
+// Um fallback booleano também define o 'result', para que flags booleanas
+// possam falhar "ligadas" (ex: uma flag de operação que precisa continuar ativa).
+func withFlagValues(decision Decision, flag *Flag) Decision {
+	if flag == nil || decision.Result {
+		return decision
+	}
+	if decision.Reason.Kind == ReasonError && flag.FallbackValue != nil {
+		return withValue(decision, flag.FallbackValue)
+	}
+	if flag.OffValue != nil {
+		decision.Value = flag.OffValue
+	}
+	return decision
+}
+
+// withRequestDefault aplica o valor padrão enviado pelo cliente quando a
+// avaliação não chegou a um valor: flag inexistente, ou erro em uma flag sem
+// 'fallback_value' (ex: flag-service fora do ar e a flag nunca vista)
+func withRequestDefault(decision Decision, requestDefault interface{}) Decision {
+	if requestDefault == nil || decision.Value != nil {
+		return decision
+	}
+	if decision.Reason.Kind != ReasonFlagNotFound && decision.Reason.Kind != ReasonError {
+		return decision
+	}
+	return withValue(decision, requestDefault)
+}
+
+// withValue define o valor da decisão (e o 'result', se o valor for booleano)
+func withValue(decision Decision, value interface{}) Decision {
+	decision.Value = value
+	if b, ok := value.(bool); ok {
+		decision.Result = b
+	}
+	return decision
+}
+
+// parseDefaultParam interpreta o ?default= do GET: JSON (true, 10, {"a": 1})
+// ou, se não for JSON válido, a própria string (ex: ?default=blue)
+func parseDefaultParam(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	var value interface{}
+	if err := json.Unmarshal([]byte(s), &value); err == nil {
+		return value
+	}
+	return s
+}
+
+// staleCompiledFlag devolve a última versão conhecida da flag (a compilada em
+// memória, ver compile.go), mesmo que o cache do Redis já tenha expirado.
+// Usada só para saber o 'fallback_value' quando os serviços estão fora do ar.
+func staleCompiledFlag(cacheKey string) *CombinedFlagInfo {
+	compiledFlagsMu.RLock()
+	defer compiledFlagsMu.RUnlock()
+	if entry, ok := compiledFlags[cacheKey]; ok {
+		return entry.info
+	}
+	return nil
+}
+
+// staleCompiledFlags devolve a última versão conhecida de todas as flags do ambiente
+func staleCompiledFlags(environment string) map[string]*CombinedFlagInfo {
+	prefix := flagCacheKey(environment, "")
+
+	compiledFlagsMu.RLock()
+	defer compiledFlagsMu.RUnlock()
+	infos := make(map[string]*CombinedFlagInfo)
+	for key, entry := range compiledFlags {
+		if strings.HasPrefix(key, prefix) {
+			infos[strings.TrimPrefix(key, prefix)] = entry.info
+		}
+	}
+	return infos
+}
+
+// unavailableDecision é a decisão de uma flag que não pôde ser buscada
+// (serviços fora do ar): ERROR, com o 'fallback_value' da última versão
+// conhecida da flag, se houver
+func unavailableDecision(stale *CombinedFlagInfo) Decision {
+	decision := Decision{Result: false, Reason: Reason{Kind: ReasonError, ErrorKind: ErrorServiceUnavailable}}
+	if stale != nil {
+		return withFlagValues(decision, stale.Flag)
+	}
+	return decision
+}
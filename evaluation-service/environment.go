@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// parseEnvironments interpreta a ENVIRONMENTS (ex: "development,staging,production")
+func parseEnvironments(s string) []string {
+	if strings.TrimSpace(s) == "" {
+		s = "development,staging,production"
+	}
+	var environments []string
+	for _, env := range strings.Split(s, ",") {
+		if env = strings.TrimSpace(env); env != "" {
+			environments = append(environments, env)
+		}
+	}
+	return environments
+}
+
+// parseSDKKeys interpreta a SDK_KEYS, que amarra cada chave de SDK a um
+// ambiente (ex: "sdk-dev-123:development,sdk-prod-456:production")
+func parseSDKKeys(s string, environments []string) (map[string]string, error) {
+	keys := make(map[string]string)
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		key, env, found := strings.Cut(item, ":")
+		if !found || key == "" {
+			return nil, fmt.Errorf("item inválido '%s' (use chave:ambiente)", item)
+		}
+		if !containsString(environments, env) {
+			return nil, fmt.Errorf("ambiente desconhecido '%s' para a chave de SDK", env)
+		}
+		keys[key] = env
+	}
+	return keys, nil
+}
+
+// requestEnvironment descobre o ambiente da requisição: o da chave de SDK
+// (header X-SDK-Key) ou o do header X-Environment.
+// Na dúvida, falha fechado: sem ambiente, chave ou ambiente desconhecidos (ou
+// um X-Environment diferente do ambiente da chave) encerram a requisição
+// com erro, em vez de avaliar as flags de outro ambiente.
+func (a *App) requestEnvironment(w http.ResponseWriter, r *http.Request) (string, bool) {
+	requested := r.Header.Get("X-Environment")
+
+	if sdkKey := r.Header.Get("X-SDK-Key"); sdkKey != "" {
+		env, ok := a.SDKKeys[sdkKey]
+		if !ok {
+			http.Error(w, `{"error": "Chave de SDK inválida"}`, http.StatusUnauthorized)
+			return "", false
+		}
+		if requested != "" && requested != env {
+			http.Error(w, `{"error": "A chave de SDK não pertence ao ambiente informado"}`, http.StatusForbidden)
+			return "", false
+		}
+		return env, true
+	}
+
+	if requested == "" {
+		http.Error(w, `{"error": "Informe o ambiente (header X-SDK-Key ou X-Environment)"}`, http.StatusBadRequest)
+		return "", false
+	}
+	if !containsString(a.Environments, requested) {
+		http.Error(w, `{"error": "Ambiente desconhecido"}`, http.StatusBadRequest)
+		return "", false
+	}
+	return requested, true
+}
+
+// environmentQuery é o parâmetro de ambiente nas chamadas ao flag/targeting-service
+func environmentQuery(environment string) string {
+	return "environment=" + url.QueryEscape(environment)
+}
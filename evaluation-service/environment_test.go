@@ -0,0 +1,48 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequestEnvironment(t *testing.T) {
+	app := &App{
+		Environments: []string{"development", "staging", "production"},
+		SDKKeys:      map[string]string{"sdk-staging-123": "staging"},
+	}
+
+	tests := []struct {
+		name       string
+		sdkKey     string
+		env        string
+		wantEnv    string
+		wantStatus int
+	}{
+		{"chave de SDK", "sdk-staging-123", "", "staging", http.StatusOK},
+		{"chave e header iguais", "sdk-staging-123", "staging", "staging", http.StatusOK},
+		{"header", "", "development", "development", http.StatusOK},
+		{"sem ambiente", "", "", "", http.StatusBadRequest},
+		{"ambiente desconhecido", "", "qa", "", http.StatusBadRequest},
+		{"chave desconhecida", "sdk-xyz", "", "", http.StatusUnauthorized},
+		{"header diferente da chave", "sdk-staging-123", "production", "", http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/evaluate", nil)
+			if tt.sdkKey != "" {
+				r.Header.Set("X-SDK-Key", tt.sdkKey)
+			}
+			if tt.env != "" {
+				r.Header.Set("X-Environment", tt.env)
+			}
+			w := httptest.NewRecorder()
+
+			env, ok := app.requestEnvironment(w, r)
+			if ok != (tt.wantStatus == http.StatusOK) || env != tt.wantEnv || w.Code != tt.wantStatus {
+				t.Errorf("ambiente %q (ok=%v, status %d), esperado %q (status %d)", env, ok, w.Code, tt.wantEnv, tt.wantStatus)
+			}
+		})
+	}
+}
@@ -1,47 +1,58 @@
 package main
 
 import (
-	"crypto/sha1" // Usado para hash determinístico
-	"encoding/binary"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
+	"strings"
 	"sync"
 	"time"
 )
 
 const (
-	// Tempo de vida do cache em segundos
+	// Tempo de vida do cache em segundos.
+	// O cache guarda só a DEFINIÇÃO das regras: regras agendadas (TIME_WINDOW,
+	// RAMP) são calculadas com o horário de cada avaliação, então o cache não
+	// atrasa mudanças agendadas. Só edições manuais levam até CACHE_TTL para valer.
 	CACHE_TTL = 30 * time.Second
 )
 
 // getDecision é o wrapper principal
-func (a *App) getDecision(userID, flagName string) (bool, error) {
-	// 1. Obter os dados da flag (do cache ou dos serviços)
-	info, err := a.getCombinedFlagInfo(flagName)
+func (a *App) getDecision(evalCtx *EvaluationContext, flagName string) (Decision, error) {
+	// 1. Obter os dados da flag no ambiente (do cache ou dos serviços)
+	info, err := a.getCombinedFlagInfo(evalCtx.Environment, flagName)
 	if err != nil {
-		return false, err
+		// Flag inexistente não é um erro: retornamos 'false' (comportamento seguro)
+		if _, ok := err.(*NotFoundError); ok {
+			return Decision{Result: false, Reason: Reason{Kind: ReasonFlagNotFound}}, nil
+		}
+		// Outros erros (serviços offline, etc): usa o 'fallback_value' da
+		// última versão conhecida da flag, se houver
+		return unavailableDecision(staleCompiledFlag(flagCacheKey(evalCtx.Environment, flagName))), err
 	}
 
 	// 2. Executar a lógica de avaliação
-	return a.runEvaluationLogic(info, userID), nil
+	return a.runEvaluationLogic(info, evalCtx), nil
 }
 
 // getCombinedFlagInfo busca os dados no Redis, com fallback para os microsserviços
-func (a *App) getCombinedFlagInfo(flagName string) (*CombinedFlagInfo, error) {
-	cacheKey := fmt.Sprintf("flag_info:%s", flagName)
+func (a *App) getCombinedFlagInfo(environment, flagName string) (*CombinedFlagInfo, error) {
+	cacheKey := flagCacheKey(environment, flagName)
 
 	// 1. Tentar buscar do Cache (Redis)
 	val, err := a.RedisClient.Get(ctx, cacheKey).Result()
 	if err == nil {
-		// Cache HIT
-		var info CombinedFlagInfo
-		if err := json.Unmarshal([]byte(val), &info); err == nil {
+		// Cache HIT: se o payload não mudou, usa a flag já compilada em memória
+		// (sem desserializar de novo, ver compile.go)
+		info, err := getCompiledFlag(cacheKey, val)
+		if err == nil {
 			log.Printf("Cache HIT para flag '%s'", flagName)
-			return &info, nil
+			return info, nil
 		}
 		// Se o unmarshal falhar, trata como cache miss
 		log.Printf("Erro ao desserializar cache para flag '%s': %v", flagName, err)
@@ -49,60 +60,80 @@ func (a *App) getCombinedFlagInfo(flagName string) (*CombinedFlagInfo, error) {
 	
 	log.Printf("Cache MISS para flag '%s'", flagName)
 	// 2. Cache MISS - Buscar dos serviços
-	info, err := a.fetchFromServices(flagName)
+	info, err := a.fetchFromServices(environment, flagName)
 	if err != nil {
 		return nil, err
 	}
 
-	// 3. Salvar no Cache
+	// 3. Salvar no Cache (e a versão compilada em memória)
 	jsonData, err := json.Marshal(info)
 	if err == nil {
 		a.RedisClient.Set(ctx, cacheKey, jsonData, CACHE_TTL).Err()
+		storeCompiledFlag(cacheKey, string(jsonData), info)
 	}
 
 	return info, nil
 }
 
 // fetchFromServices busca dados do flag-service e targeting-service concorrentemente
-func (a *App) fetchFromServices(flagName string) (*CombinedFlagInfo, error) {
+func (a *App) fetchFromServices(environment, flagName string) (*CombinedFlagInfo, error) {
 	var wg sync.WaitGroup
-	wg.Add(2)
+	wg.Add(3)
 
 	var flagInfo *Flag
 	var ruleInfo *TargetingRule
-	var flagErr, ruleErr error
+	var overrides []Override
+	var flagErr, ruleErr, overrideErr error
 
 	// Goroutine 1: Buscar do flag-service
 	go func() {
 		defer wg.Done()
-		flagInfo, flagErr = a.fetchFlag(flagName)
+		flagInfo, flagErr = a.fetchFlag(environment, flagName)
 	}()
 
 	// Goroutine 2: Buscar do targeting-service
 	go func() {
 		defer wg.Done()
-		ruleInfo, ruleErr = a.fetchRule(flagName)
+		ruleInfo, ruleErr = a.fetchRule(environment, flagName)
+	}()
+
+	// Goroutine 3: Buscar os overrides por usuário (também do targeting-service)
+	go func() {
+		defer wg.Done()
+		overridesURL := fmt.Sprintf("%s/overrides?flag_name=%s&%s", a.TargetingServiceURL, url.QueryEscape(flagName), environmentQuery(environment))
+		overrideErr = a.fetchList(overridesURL, "targeting-service", &overrides)
 	}()
 
-	wg.Wait() // Espera ambas as chamadas terminarem
+	wg.Wait() // Espera as três chamadas terminarem
 
 	if flagErr != nil {
 		return nil, flagErr // Se a flag não existe, não podemos fazer nada
 	}
 	// Se a regra não existir, não é um erro fatal. Usaremos um 'nil'
-	if ruleErr != nil {
+	if _, ok := ruleErr.(*NotFoundError); ok {
 		log.Printf("Aviso: Nenhuma regra de segmentação encontrada para '%s'. Usando padrão.", flagName)
+		ruleErr = nil
+	}
+	// Qualquer outra falha do targeting-service É fatal (como no bulk.go): sem a
+	// regra, a flag seria liberada para 100% dos usuários (e ficaria no cache)
+	if ruleErr != nil {
+		return nil, ruleErr
+	}
+	// Sem os overrides, a flag é avaliada normalmente pelas regras
+	if overrideErr != nil {
+		log.Printf("Aviso: Erro ao buscar overrides da flag '%s': %v", flagName, overrideErr)
 	}
 
 	return &CombinedFlagInfo{
-		Flag: flagInfo,
-		Rule: ruleInfo,
+		Flag:      flagInfo,
+		Rule:      ruleInfo,
+		Overrides: overrides,
 	}, nil
 }
 
 // fetchFlag (função helper)
-func (a *App) fetchFlag(flagName string) (*Flag, error) {
-	url := fmt.Sprintf("%s/flags/%s", a.FlagServiceURL, flagName)
+func (a *App) fetchFlag(environment, flagName string) (*Flag, error) {
+	url := fmt.Sprintf("%s/flags/%s?%s", a.FlagServiceURL, flagName, environmentQuery(environment))
 	
 	// Os serviços admin (flag/targeting) precisam de auth
 	// Este serviço (evaluation) não tem uma chave de admin.
@@ -240,8 +271,8 @@ func (a *App) fetchFlag(flagName string) (*Flag, error) {
 }
 
 // fetchRule (função helper)
-func (a *App) fetchRule(flagName string) (*TargetingRule, error) {
-	url := fmt.Sprintf("%s/rules/%s", a.TargetingServiceURL, flagName)
+func (a *App) fetchRule(environment, flagName string) (*TargetingRule, error) {
+	url := fmt.Sprintf("%s/rules/%s?%s", a.TargetingServiceURL, flagName, environmentQuery(environment))
 	apiKey := os.Getenv("SERVICE_API_KEY") // Usa a mesma chave
 	req, _ := http.NewRequest("GET", url, nil)
 	req.Header.Set("Authorization", "Bearer "+apiKey)
@@ -267,53 +298,223 @@ func (a *App) fetchRule(flagName string) (*TargetingRule, error) {
 	return &rule, nil
 }
 
-// runEvaluationLogic é onde a decisão é tomada
-func (a *App) runEvaluationLogic(info *CombinedFlagInfo, userID string) bool {
+// runEvaluationLogic é onde a decisão é tomada. Flags desligadas para o
+// usuário (ou com erro) recebem o 'off_value'/'fallback_value' da flag.
+func (a *App) runEvaluationLogic(info *CombinedFlagInfo, evalCtx *EvaluationContext) Decision {
+	return withFlagValues(a.evaluateFlag(info, evalCtx, nil), info.Flag)
+}
+
+// evaluateFlag avalia uma flag. 'stack' são as flags que estão sendo avaliadas
+// acima desta (por serem pré-requisitos), usada para detectar ciclos.
+func (a *App) evaluateFlag(info *CombinedFlagInfo, evalCtx *EvaluationContext, stack []string) Decision {
 	// 1. Verificação do "Kill Switch" global
 	if info.Flag == nil || !info.Flag.IsEnabled {
-		return false // Flag desativada globalmente
+		// Flag desativada globalmente
+		return Decision{Result: false, Reason: Reason{Kind: ReasonFlagDisabled}}
+	}
+
+	e := &evaluation{
+		app:         a,
+		flag:        info.Flag,
+		evalCtx:     evalCtx,
+		hashVersion: HashVersionLegacy,
+		now:         a.now(),
+	}
+
+	// 2. Override forçado para este usuário (ex: QA): vence qualquer regra
+	if override := info.override(evalCtx.Key, e.now); override != nil {
+		decision := e.outcomeDecision(Outcome{Enabled: override.Enabled, Variation: override.Variation})
+		decision.Reason = Reason{Kind: ReasonOverride}
+		return decision
+	}
+
+	// 3. Holdout global: uma fatia fixa dos usuários não vê nenhuma flag
+	// (exceto as isentas, ex: correções de segurança), para medir o impacto acumulado
+	if !info.Flag.HoldoutExempt && a.inHoldout(evalCtx.Key) {
+		return Decision{Result: false, Reason: Reason{Kind: ReasonHoldout}}
 	}
 
-	// 2. Verifica se existe uma regra de segmentação
+	// 4. Pré-requisitos: outras flags que precisam ter um resultado específico.
+	// Valem mesmo com a regra desativada: desligar o targeting não pode
+	// liberar uma sub-feature cuja flag principal está desligada.
+	if info.Rule != nil && len(info.Rule.Rules.Prerequisites) > 0 {
+		path := append(append([]string{}, stack...), info.Flag.Name)
+		if decision, ok := a.checkPrerequisites(info.Rule.Rules.Prerequisites, evalCtx, path); !ok {
+			return decision
+		}
+	}
+
+	// 5. Verifica se existe uma regra de segmentação
 	if info.Rule == nil || !info.Rule.IsEnabled {
 		// Não há regra ou a regra está desativada.
 		// Retorna o estado global da flag (que sabemos ser 'true' do passo 1)
-		return true
+		decision := e.onDecision()
+		decision.Reason = Reason{Kind: ReasonNoRule}
+		return decision
+	}
+
+	ruleSet := info.Rule.Rules
+	if ruleSet.HashVersion != 0 {
+		e.hashVersion = ruleSet.HashVersion
 	}
 
-	// 3. Processa a regra (só temos "PERCENTAGE" por enquanto)
-	rule := info.Rule.Rules
-	if rule.Type == "PERCENTAGE" {
-		// Converte o 'value' (que é interface{}) para float64
-		percentage, ok := rule.Value.(float64)
-		if !ok {
-			log.Printf("Erro: valor da regra de porcentagem não é um número para a flag '%s'", info.Flag.Name)
-			return false
+	// Camada de experimentos: fora da fatia desta flag, o usuário pertence
+	// (ou pode pertencer) a outro experimento da camada
+	if ruleSet.Layer != nil && !e.inLayer(ruleSet.Layer) {
+		return Decision{Result: false, Reason: Reason{Kind: ReasonLayerExcluded, Layer: ruleSet.Layer.Name}}
+	}
+
+	// 6. Avalia as regras em ordem: a primeira atendida define o resultado
+	for _, flagRule := range ruleSet.Rules {
+		matched, err := e.evaluateRule(flagRule.Condition)
+		if err != nil {
+			log.Printf("Erro ao avaliar a regra '%s' da flag '%s': %v", flagRule.ID, info.Flag.Name, err)
+			return a.ruleErrorDecision(e, ruleSet, err)
 		}
-		
-		// Calcula o "bucket" do usuário (0-99)
-		userBucket := getDeterministicBucket(userID + info.Flag.Name)
-		
-		if float64(userBucket) < percentage {
-			return true
+		if matched {
+			decision := e.outcomeDecision(flagRule.Outcome)
+			decision.Reason = Reason{Kind: ReasonRuleMatch, RuleID: flagRule.ID}
+			return decision
 		}
 	}
 
-	// O padrão é 'false' se a regra não for atendida
-	return false
+	// 7. Nenhuma regra atendida: usa o resultado padrão (fallthrough)
+	decision := e.outcomeDecision(ruleSet.Fallthrough)
+	decision.Reason = Reason{Kind: ReasonFallthrough}
+	return decision
 }
 
-// getDeterministicBucket gera um "dado" de 100 faces (0-99)
-// que é sempre o mesmo para a mesma string de entrada.
-func getDeterministicBucket(input string) int {
-	// Usamos SHA1 (rápido) e pegamos os primeiros 4 bytes
-	hasher := sha1.New()
-	hasher.Write([]byte(input))
-	hash := hasher.Sum(nil)
-	
-	// Converte 4 bytes para um uint32
-	val := binary.BigEndian.Uint32(hash[:4])
-	
-	// Retorna o módulo 100
-	return int(val % 100)
-}
\ No newline at end of file
+// checkPrerequisites avalia (recursivamente) os pré-requisitos de uma flag.
+// Retorna 'false' e a decisão final se algum deles não for atendido.
+func (a *App) checkPrerequisites(prereqs []Prerequisite, evalCtx *EvaluationContext, path []string) (Decision, bool) {
+	for _, prereq := range prereqs {
+		// Ciclo (ex: A depende de B que depende de A): erro claro em vez de recursão infinita
+		if containsString(path, prereq.Flag) {
+			log.Printf("Erro: ciclo de pré-requisitos: %s -> %s", strings.Join(path, " -> "), prereq.Flag)
+			return Decision{Result: false, Reason: Reason{Kind: ReasonError, ErrorKind: ErrorPrerequisiteCycle}}, false
+		}
+
+		failed := Decision{Result: false, Reason: Reason{Kind: ReasonPrerequisiteFailed, Prerequisite: prereq.Flag}}
+
+		// Pré-requisitos são sempre do mesmo ambiente da flag
+		info, err := a.getCombinedFlagInfo(evalCtx.Environment, prereq.Flag)
+		if err != nil {
+			// Pré-requisito inexistente nunca é atendido
+			if _, ok := err.(*NotFoundError); ok {
+				return failed, false
+			}
+			log.Printf("Erro ao buscar o pré-requisito '%s': %v", prereq.Flag, err)
+			return Decision{Result: false, Reason: Reason{Kind: ReasonError, ErrorKind: ErrorServiceUnavailable}}, false
+		}
+
+		decision := a.evaluateFlag(info, evalCtx, path)
+		// Erros no pré-requisito (inclusive ciclos mais abaixo) são propagados
+		if decision.Reason.Kind == ReasonError {
+			return Decision{Result: false, Reason: decision.Reason}, false
+		}
+		if !prereq.satisfiedBy(decision) {
+			return failed, false
+		}
+	}
+	return Decision{}, true
+}
+
+// now retorna o horário atual pelo relógio da App (injetável)
+func (a *App) now() time.Time {
+	if a.Clock != nil {
+		return a.Clock()
+	}
+	return time.Now()
+}
+
+// errorKind classifica um erro de avaliação para o Reason.ErrorKind
+func errorKind(err error) string {
+	var ruleErr *RuleError
+	if errors.As(err, &ruleErr) {
+		return ruleErr.Kind
+	}
+	return ErrorMalformedRule
+}
+
+// onDecision monta a decisão de uma flag liberada para o usuário.
+// Para flags multivariadas, sorteia (deterministicamente) a variação.
+func (e *evaluation) onDecision() Decision {
+	return e.splitDecision(e.flag.Variations, Bucketing{})
+}
+
+// splitDecision sorteia uma das variações de acordo com os pesos
+func (e *evaluation) splitDecision(variations []Variation, bucketing Bucketing) Decision {
+	// Sem o atributo de bucketing no contexto, o sorteio usa a chave do contexto
+	key, ok := e.bucketKey(bucketing)
+	if !ok {
+		key = e.evalCtx.Key
+	}
+
+	decision := Decision{Result: true}
+	if variation := pickVariation(variations, key+e.flag.Name+bucketing.Salt+":variation", e.hashVersion); variation != nil {
+		decision.Variation = variation.Key
+		decision.Value = variation.Value
+	}
+	return decision
+}
+
+// outcomeDecision aplica o resultado (outcome) de uma regra ou do fallthrough
+func (e *evaluation) outcomeDecision(outcome Outcome) Decision {
+	if !outcome.Enabled {
+		return Decision{Result: false}
+	}
+
+	// Variação fixa (ex: "staff sempre vê a variação 'new'")
+	if outcome.Variation != "" {
+		for _, variation := range e.flag.Variations {
+			if variation.Key == outcome.Variation {
+				return Decision{Result: true, Variation: variation.Key, Value: variation.Value}
+			}
+		}
+		log.Printf("Aviso: variação '%s' não existe na flag '%s'. Usando a divisão padrão.", outcome.Variation, e.flag.Name)
+		return e.splitDecision(e.flag.Variations, outcome.Bucketing)
+	}
+
+	// Divisão própria da regra: sobrescreve os pesos padrão das variações
+	if len(outcome.Rollout) > 0 {
+		weighted := make([]Variation, len(e.flag.Variations))
+		for i, variation := range e.flag.Variations {
+			variation.Weight = outcome.Rollout[variation.Key]
+			weighted[i] = variation
+		}
+		return e.splitDecision(weighted, outcome.Bucketing)
+	}
+
+	return e.splitDecision(e.flag.Variations, outcome.Bucketing)
+}
+
+// pickVariation escolhe uma variação de acordo com os pesos, usando o
+// mesmo "dado" determinístico das porcentagens. O sufixo ":variation" na
+// entrada evita que o sorteio da variação fique correlacionado com o
+// sorteio da regra PERCENTAGE (senão os 20% liberados cairiam todos na
+// primeira variação).
+func pickVariation(variations []Variation, input string, hashVersion int) *Variation {
+	if len(variations) == 0 {
+		return nil
+	}
+
+	totalWeight := 0.0
+	for _, v := range variations {
+		totalWeight += v.Weight
+	}
+	// Sem pesos definidos, a primeira variação é a padrão
+	if totalWeight <= 0 {
+		return &variations[0]
+	}
+
+	// Converte o bucket (0-99999) para a escala dos pesos
+	point := float64(getBucket(input, hashVersion)) / BucketScale * totalWeight
+	cumulative := 0.0
+	for i := range variations {
+		cumulative += variations[i].Weight
+		if point < cumulative {
+			return &variations[i]
+		}
+	}
+	return &variations[len(variations)-1]
+}
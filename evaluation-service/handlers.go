@@ -4,12 +4,17 @@ import (
 	"encoding/json"
 	"log"
 	"net/http"
+	"sort"
+	"strings"
 )
 
 type EvaluationResponse struct {
-	FlagName string `json:"flag_name"`
-	UserID   string `json:"user_id"`
-	Result   bool   `json:"result"`
+	FlagName  string      `json:"flag_name"`
+	UserID    string      `json:"user_id"`
+	Result    bool        `json:"result"`
+	Variation string      `json:"variation,omitempty"` // só em flags multivariadas
+	Value     interface{} `json:"value,omitempty"`
+	Reason    Reason      `json:"reason"`
 }
 
 func (a *App) healthHandler(w http.ResponseWriter, r *http.Request) {
@@ -18,41 +23,199 @@ func (a *App) healthHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
 }
 
+// EvaluationRequest é o corpo do POST /evaluate
+type EvaluationRequest struct {
+	FlagName string            `json:"flag_name"`
+	Context  EvaluationContext `json:"context"`
+	Default  interface{}       `json:"default,omitempty"` // valor se a flag não existir ou não puder ser avaliada
+}
+
 func (a *App) evaluationHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	// 1. Parsear os query parameters
-	userID := r.URL.Query().Get("user_id")
-	flagName := r.URL.Query().Get("flag_name")
+	// 1. Montar o contexto de avaliação
+	// GET: apenas a chave do usuário (query params)
+	// POST: contexto completo com atributos (corpo JSON)
+	var flagName string
+	var evalCtx EvaluationContext
+	var requestDefault interface{}
+
+	switch r.Method {
+	case http.MethodGet:
+		evalCtx.Key = r.URL.Query().Get("user_id")
+		flagName = r.URL.Query().Get("flag_name")
+		requestDefault = parseDefaultParam(r.URL.Query().Get("default"))
+
+		if evalCtx.Key == "" || flagName == "" {
+			http.Error(w, `{"error": "user_id e flag_name são obrigatórios"}`, http.StatusBadRequest)
+			return
+		}
+
+	case http.MethodPost:
+		var req EvaluationRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, `{"error": "Corpo JSON inválido"}`, http.StatusBadRequest)
+			return
+		}
+		flagName = req.FlagName
+		evalCtx = req.Context
+		requestDefault = req.Default
 
-	if userID == "" || flagName == "" {
-		http.Error(w, `{"error": "user_id e flag_name são obrigatórios"}`, http.StatusBadRequest)
+		if evalCtx.Key == "" || flagName == "" {
+			http.Error(w, `{"error": "context.key e flag_name são obrigatórios"}`, http.StatusBadRequest)
+			return
+		}
+
+	default:
+		http.Error(w, `{"error": "Método não permitido"}`, http.StatusMethodNotAllowed)
 		return
 	}
 
+	userID := evalCtx.Key
+	evalCtx.IP = a.clientIP(r)
+
+	// Ambiente (da chave de SDK ou do header). Desconhecido = erro, nunca outro ambiente
+	environment, ok := a.requestEnvironment(w, r)
+	if !ok {
+		return
+	}
+	evalCtx.Environment = environment
+
 	// 2. Obter a decisão (lógica de cache/serviço está em evaluator.go)
-	result, err := a.getDecision(userID, flagName)
+	// Flags inexistentes já voltam como 'false' com o motivo FLAG_NOT_FOUND.
+	// Com os serviços offline, a resposta continua sendo 200: ERROR com o
+	// 'fallback_value' da flag (ou o 'default' da requisição)
+	decision, err := a.getDecision(&evalCtx, flagName)
 	if err != nil {
-		// Se o erro for "não encontrado", retornamos 'false' (comportamento seguro)
-		if _, ok := err.(*NotFoundError); ok {
-			result = false
-		} else {
-			// Outros erros (serviços offline, etc)
-			log.Printf("Erro ao avaliar flag '%s': %v", flagName, err)
-			http.Error(w, `{"error": "Erro interno ao avaliar a flag"}`, http.StatusBadGateway)
-			return
-		}
+		log.Printf("Erro ao avaliar flag '%s': %v", flagName, err)
 	}
+	decision = withRequestDefault(decision, requestDefault)
 
 	// 3. Enviar evento para SQS (assincronamente)
 	// Isso não bloqueia a resposta para o cliente.
-	go a.sendEvaluationEvent(userID, flagName, result)
+	go a.sendEvaluationEvent(environment, userID, flagName, decision)
 
 	// 4. Retornar a resposta
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(EvaluationResponse{
-		FlagName: flagName,
-		UserID:   userID,
-		Result:   result,
+		FlagName:  flagName,
+		UserID:    userID,
+		Result:    decision.Result,
+		Variation: decision.Variation,
+		Value:     decision.Value,
+		Reason:    decision.Reason,
 	})
-}
\ No newline at end of file
+}
+
+// BulkEvaluationRequest é o corpo do POST /evaluate/all
+type BulkEvaluationRequest struct {
+	FlagNames []string               `json:"flag_names"` // vazio = todas as flags
+	Context   EvaluationContext      `json:"context"`
+	Defaults  map[string]interface{} `json:"defaults,omitempty"` // valor padrão por flag (ver EvaluationRequest.Default)
+}
+
+// BulkEvaluationResponse é a resposta do /evaluate/all
+type BulkEvaluationResponse struct {
+	UserID  string               `json:"user_id"`
+	Results []EvaluationResponse `json:"results"`
+}
+
+// evaluateAllHandler avalia várias flags (ou todas) para um usuário em uma única chamada
+func (a *App) evaluateAllHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// 1. Montar o contexto de avaliação e a lista de flags
+	// GET: ?user_id=...&flags=a,b,c (sem 'flags' = todas)
+	// POST: {"context": {...}, "flag_names": [...]}
+	var flagNames []string
+	var evalCtx EvaluationContext
+	var defaults map[string]interface{}
+
+	switch r.Method {
+	case http.MethodGet:
+		evalCtx.Key = r.URL.Query().Get("user_id")
+		if flags := r.URL.Query().Get("flags"); flags != "" {
+			for _, name := range strings.Split(flags, ",") {
+				if name = strings.TrimSpace(name); name != "" {
+					flagNames = append(flagNames, name)
+				}
+			}
+		}
+
+	case http.MethodPost:
+		var req BulkEvaluationRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, `{"error": "Corpo JSON inválido"}`, http.StatusBadRequest)
+			return
+		}
+		flagNames = req.FlagNames
+		evalCtx = req.Context
+		defaults = req.Defaults
+
+	default:
+		http.Error(w, `{"error": "Método não permitido"}`, http.StatusMethodNotAllowed)
+		return
+	}
+
+	if evalCtx.Key == "" {
+		http.Error(w, `{"error": "user_id (ou context.key) é obrigatório"}`, http.StatusBadRequest)
+		return
+	}
+	evalCtx.IP = a.clientIP(r)
+
+	environment, ok := a.requestEnvironment(w, r)
+	if !ok {
+		return
+	}
+	evalCtx.Environment = environment
+
+	// 2. Buscar os dados de todas as flags do ambiente de uma vez (cache em lote / serviços).
+	// Com os serviços offline, as flags voltam como ERROR (com o 'fallback_value'
+	// da última versão conhecida de cada uma), e não como um erro da requisição.
+	infos, err := a.getCombinedFlagInfos(environment, flagNames)
+	unavailable := err != nil
+	if unavailable {
+		log.Printf("Erro ao buscar flags em lote: %v", err)
+		infos = staleCompiledFlags(environment)
+	}
+
+	// Sem lista explícita, avalia todas as flags encontradas (em ordem alfabética)
+	if len(flagNames) == 0 {
+		for name := range infos {
+			flagNames = append(flagNames, name)
+		}
+		sort.Strings(flagNames)
+	}
+
+	// 3. Avaliar cada flag
+	decisions := make(map[string]Decision, len(flagNames))
+	response := BulkEvaluationResponse{UserID: evalCtx.Key, Results: make([]EvaluationResponse, 0, len(flagNames))}
+	for _, flagName := range flagNames {
+		if _, done := decisions[flagName]; done {
+			continue // nome repetido na lista
+		}
+		decision := Decision{Result: false, Reason: Reason{Kind: ReasonFlagNotFound}}
+		if unavailable {
+			decision = unavailableDecision(infos[flagName])
+		} else if info, ok := infos[flagName]; ok {
+			decision = a.runEvaluationLogic(info, &evalCtx)
+		}
+		decision = withRequestDefault(decision, defaults[flagName])
+		decisions[flagName] = decision
+		response.Results = append(response.Results, EvaluationResponse{
+			FlagName:  flagName,
+			UserID:    evalCtx.Key,
+			Result:    decision.Result,
+			Variation: decision.Variation,
+			Value:     decision.Value,
+			Reason:    decision.Reason,
+		})
+	}
+
+	// 4. Enviar os eventos para SQS em lote (assincronamente)
+	go a.sendEvaluationEvents(environment, evalCtx.Key, decisions)
+
+	// 5. Retornar a resposta
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
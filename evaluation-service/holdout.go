@@ -0,0 +1,29 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// parseHoldoutPercentage interpreta a HOLDOUT_PERCENTAGE (0-100, vazia = 0)
+func parseHoldoutPercentage(s string) (float64, error) {
+	if strings.TrimSpace(s) == "" {
+		return 0, nil
+	}
+	percentage, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil || percentage < 0 || percentage > 100 {
+		return 0, fmt.Errorf("'%s' não é uma porcentagem entre 0 e 100", s)
+	}
+	return percentage, nil
+}
+
+// inHoldout verifica se a chave está no holdout global. O bucket usa um hash
+// próprio (chave + ":holdout"), independente de qualquer flag, então o
+// mesmo usuário fica no holdout para todas as flags e em todas as avaliações.
+func (a *App) inHoldout(key string) bool {
+	if a.HoldoutPercentage <= 0 {
+		return false
+	}
+	return getBucket(key+":holdout", HashVersionHighRes) < percentageThreshold(a.HoldoutPercentage)
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// parseTrustedProxies interpreta a TRUSTED_PROXIES: CIDRs ou IPs separados
+// por vírgula (ex: "10.0.0.0/8,fd00::/8,127.0.0.1")
+func parseTrustedProxies(s string) ([]netip.Prefix, error) {
+	var proxies []netip.Prefix
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		prefix, err := parsePrefix(item)
+		if err != nil {
+			return nil, err
+		}
+		proxies = append(proxies, prefix)
+	}
+	return proxies, nil
+}
+
+// parsePrefix aceita um CIDR ou um IP isolado (equivalente a /32 ou /128)
+func parsePrefix(s string) (netip.Prefix, error) {
+	if strings.Contains(s, "/") {
+		prefix, err := netip.ParsePrefix(s)
+		if err != nil {
+			return netip.Prefix{}, fmt.Errorf("CIDR inválido '%s'", s)
+		}
+		// IPv4 mapeado em IPv6 (::ffff:10.0.0.0/104) vira IPv4
+		if prefix.Addr().Is4In6() && prefix.Bits() >= 96 {
+			prefix = netip.PrefixFrom(prefix.Addr().Unmap(), prefix.Bits()-96)
+		}
+		return prefix.Masked(), nil
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("IP inválido '%s'", s)
+	}
+	addr = addr.Unmap()
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// clientIP descobre o IP de quem chamou o serviço.
+// O X-Forwarded-For só é considerado se a conexão vier de um proxy confiável
+// (ex: o Ingress); nesse caso, a lista é percorrida da direita para a
+// esquerda e o primeiro IP que não for de um proxy confiável é o cliente.
+// Sem isso, qualquer cliente poderia forjar o próprio IP no header.
+func (a *App) clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	remote, err := netip.ParseAddr(host)
+	if err != nil {
+		return ""
+	}
+	// A zona de um IPv6 link-local (fe80::1%eth0) é da interface de rede,
+	// não do cliente; com ela, o IP nunca casaria com um CIDR
+	remote = remote.Unmap().WithZone("")
+	if !a.isTrustedProxy(remote) {
+		return remote.String()
+	}
+
+	var hops []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(header, ",")...)
+	}
+	client := remote
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			// Entrada inválida: não dá para confiar no que vem antes dela
+			break
+		}
+		client = addr.Unmap().WithZone("")
+		if !a.isTrustedProxy(client) {
+			break
+		}
+	}
+	return client.String()
+}
+
+// isTrustedProxy verifica se o IP pertence à TRUSTED_PROXIES
+func (a *App) isTrustedProxy(addr netip.Addr) bool {
+	for _, prefix := range a.TrustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchCIDR verifica se o atributo (um IPv4 ou IPv6) pertence ao CIDR da
+// cláusula. Um atributo que não é IP não casa; um CIDR inválido é erro da regra.
+func matchCIDR(attrValue, value interface{}) (bool, error) {
+	str, ok := value.(string)
+	if !ok {
+		return false, newRuleError("CIDR inválido na cláusula: %v", value)
+	}
+	prefix, err := parsePrefix(str)
+	if err != nil {
+		return false, newRuleError("%v", err)
+	}
+
+	attrString, ok := attrValue.(string)
+	if !ok {
+		return false, nil
+	}
+	addr, err := netip.ParseAddr(attrString)
+	if err != nil {
+		return false, nil
+	}
+	return prefix.Contains(addr.Unmap()), nil
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	proxies, err := parseTrustedProxies("10.0.0.0/8, fd00::/8, fe80::1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := &App{TrustedProxies: proxies}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		xff        []string // um item por header X-Forwarded-For
+		want       string
+	}{
+		{"sem proxy", "203.0.113.7:51234", nil, "203.0.113.7"},
+		{"conexão não confiável ignora o header", "203.0.113.7:51234", []string{"198.51.100.1"}, "203.0.113.7"},
+		{"conexão não confiável com proxy forjado", "203.0.113.7:51234", []string{"10.0.0.5"}, "203.0.113.7"},
+		{"proxy confiável", "10.0.0.1:443", []string{"198.51.100.1"}, "198.51.100.1"},
+		{"entrada forjada à esquerda", "10.0.0.1:443", []string{"6.6.6.6, 198.51.100.1"}, "198.51.100.1"},
+		{"várias entradas forjadas", "10.0.0.1:443", []string{"6.6.6.6, 7.7.7.7, 198.51.100.1, 10.0.0.2"}, "198.51.100.1"},
+		{"vários headers", "10.0.0.1:443", []string{"6.6.6.6", "198.51.100.1, 10.0.0.2"}, "198.51.100.1"},
+		{"entrada inválida", "10.0.0.1:443", []string{"198.51.100.1, lixo, 10.0.0.2"}, "10.0.0.2"},
+		{"só proxies", "10.0.0.1:443", []string{"10.0.0.3, 10.0.0.2"}, "10.0.0.3"},
+		{"proxy sem header", "10.0.0.1:443", nil, "10.0.0.1"},
+		{"header vazio", "10.0.0.1:443", []string{""}, "10.0.0.1"},
+		{"header só com espaços e vírgulas", "10.0.0.1:443", []string{" , "}, "10.0.0.1"},
+		{"IPv4 mapeado em IPv6", "[::ffff:10.0.0.1]:443", []string{"::ffff:198.51.100.1"}, "198.51.100.1"},
+		{"proxy IPv6", "[fd00::1]:443", []string{"2001:db8::1"}, "2001:db8::1"},
+		{"IPv6 com zona", "[fe80::2%eth0]:51234", nil, "fe80::2"},
+		{"proxy IPv6 com zona", "[fe80::1%eth0]:443", []string{"198.51.100.1"}, "198.51.100.1"},
+		{"entrada IPv6 com zona", "10.0.0.1:443", []string{"fe80::2%eth0"}, "fe80::2"},
+		{"RemoteAddr sem porta", "203.0.113.7", nil, "203.0.113.7"},
+		{"RemoteAddr inválido", "@", []string{"198.51.100.1"}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/evaluate", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for _, header := range tt.xff {
+				r.Header.Add("X-Forwarded-For", header)
+			}
+			if got := app.clientIP(r); got != tt.want {
+				t.Errorf("IP %q, esperado %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,12 @@
+package main
+
+// inLayer verifica se o usuário caiu na fatia da camada ocupada por esta flag.
+// O bucket vem de um hash da CAMADA (chave + nome da camada), e não de
+// 'chave + flag': assim todas as flags da camada enxergam o mesmo bucket
+// para o mesmo usuário, e fatias que não se sobrepõem nunca dividem usuários.
+// A camada usa sempre o hash de alta resolução, para não depender do
+// 'hash_version' de cada flag.
+func (e *evaluation) inLayer(layer *Layer) bool {
+	bucket := getBucket(e.evalCtx.Key+":layer:"+layer.Name, HashVersionHighRes)
+	return bucket >= percentageThreshold(layer.Start) && bucket < percentageThreshold(layer.End)
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"log"
 	"net/http"
+	"net/netip"
 	"os"
 	"time"
 
@@ -26,6 +27,13 @@ type App struct {
 	HttpClient          *http.Client
 	FlagServiceURL      string
 	TargetingServiceURL string
+	AuthServiceURL      string            // valida as chaves dos endpoints /admin
+	Clock               func() time.Time  // relógio das regras agendadas (nil = time.Now)
+	TrustedProxies      []netip.Prefix    // proxies cujo X-Forwarded-For é aceito (ex: o Ingress)
+	Environments        []string          // ambientes aceitos (ex: development, staging, production)
+	SDKKeys             map[string]string // chave de SDK -> ambiente
+	HoldoutPercentage   float64           // % dos usuários no holdout global (0 = desligado)
+	UnknownRulePolicy   string            // o que fazer com tipos de regra desconhecidos (ver registry.go)
 }
 
 func main() {
@@ -52,6 +60,37 @@ func main() {
 		log.Fatal("TARGETING_SERVICE_URL deve ser definida")
 	}
 
+	// Sem o auth-service, os endpoints /admin ficam desabilitados
+	authSvcURL := os.Getenv("AUTH_SERVICE_URL")
+	if authSvcURL == "" {
+		log.Println("Atenção: AUTH_SERVICE_URL não definida. Endpoints /admin desabilitados.")
+	}
+
+	// Proxies confiáveis (ex: o Ingress) para descobrir o IP real do cliente
+	trustedProxies, err := parseTrustedProxies(os.Getenv("TRUSTED_PROXIES"))
+	if err != nil {
+		log.Fatalf("TRUSTED_PROXIES inválida: %v", err)
+	}
+
+	// Ambientes e chaves de SDK (cada chave só avalia flags do seu ambiente)
+	environments := parseEnvironments(os.Getenv("ENVIRONMENTS"))
+	sdkKeys, err := parseSDKKeys(os.Getenv("SDK_KEYS"), environments)
+	if err != nil {
+		log.Fatalf("SDK_KEYS inválida: %v", err)
+	}
+
+	// Holdout global (ex: 5% dos usuários sem nenhuma flag nova)
+	holdoutPercentage, err := parseHoldoutPercentage(os.Getenv("HOLDOUT_PERCENTAGE"))
+	if err != nil {
+		log.Fatalf("HOLDOUT_PERCENTAGE inválida: %v", err)
+	}
+
+	// Tipos de regra desconhecidos: fail_closed (padrão), fail_open ou flag_default
+	unknownRulePolicy, err := parseUnknownRuleTypePolicy(os.Getenv("UNKNOWN_RULE_TYPE_POLICY"))
+	if err != nil {
+		log.Fatalf("UNKNOWN_RULE_TYPE_POLICY inválida: %v", err)
+	}
+
 	// SQS é opcional no dev local, mas obrigatório em prod
 	sqsQueueURL := os.Getenv("AWS_SQS_URL")
 	awsRegion := os.Getenv("AWS_REGION")
@@ -117,12 +156,23 @@ func main() {
 		HttpClient:          httpClient,
 		FlagServiceURL:      flagSvcURL,
 		TargetingServiceURL: targetingSvcURL,
+		AuthServiceURL:      authSvcURL,
+		TrustedProxies:      trustedProxies,
+		Environments:        environments,
+		SDKKeys:             sdkKeys,
+		HoldoutPercentage:   holdoutPercentage,
+		UnknownRulePolicy:   unknownRulePolicy,
+		Clock:               time.Now,
 	}
 
 	// --- Rotas ---
 	mux := http.NewServeMux()
 	mux.HandleFunc("/health", app.healthHandler)
 	mux.HandleFunc("/evaluate", app.evaluationHandler)
+	mux.HandleFunc("/evaluate/all", app.evaluateAllHandler)
+	mux.HandleFunc("/admin/big-segments/", app.requireAuth(app.bigSegmentHandler))
+	mux.HandleFunc("/admin/simulate", app.requireAuth(app.simulateHandler))
+	mux.HandleFunc("/admin/rules/validate", app.requireAuth(app.validateRulesHandler))
 
 	log.Printf("Serviço de Avaliação (Go) rodando na porta %s", port)
 	if err := http.ListenAndServe(":"+port, mux); err != nil {
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// newPrerequisiteTestApp cria uma App sem Redis (toda leitura é cache MISS)
+// cujos flag/targeting-service são um servidor de teste com as flags informadas
+func newPrerequisiteTestApp(t *testing.T, flags map[string]Flag) *App {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/flags/"):
+			flag, ok := flags[strings.TrimPrefix(r.URL.Path, "/flags/")]
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			json.NewEncoder(w).Encode(flag)
+		case r.URL.Path == "/overrides":
+			w.Write([]byte("[]"))
+		default: // nenhuma flag de pré-requisito tem regra
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	redisClient := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", DialTimeout: 50 * time.Millisecond, MaxRetries: -1})
+	t.Cleanup(func() { redisClient.Close() })
+
+	return &App{
+		RedisClient:         redisClient,
+		HttpClient:          server.Client(),
+		FlagServiceURL:      server.URL,
+		TargetingServiceURL: server.URL,
+	}
+}
+
+// Os pré-requisitos valem mesmo com a regra de segmentação desativada
+func TestPrerequisitesWithDisabledRule(t *testing.T) {
+	app := newPrerequisiteTestApp(t, map[string]Flag{
+		"enable-new-checkout": {Name: "enable-new-checkout", IsEnabled: false},
+		"enable-new-cart":     {Name: "enable-new-cart", IsEnabled: true},
+	})
+
+	tests := []struct {
+		name       string
+		prereq     string
+		wantResult bool
+		wantReason string
+	}{
+		{"pré-requisito desligado", "enable-new-checkout", false, ReasonPrerequisiteFailed},
+		{"pré-requisito inexistente", "enable-checkout-v0", false, ReasonPrerequisiteFailed},
+		{"pré-requisito ligado", "enable-new-cart", true, ReasonNoRule},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var rule TargetingRule
+			raw := `{"is_enabled": false, "rules": {"prerequisites": [{"flag": "` + tt.prereq + `"}], "rules": []}}`
+			if err := json.Unmarshal([]byte(raw), &rule); err != nil {
+				t.Fatal(err)
+			}
+			info := &CombinedFlagInfo{Flag: &Flag{Name: "one-click-checkout", IsEnabled: true}, Rule: &rule}
+
+			got := app.runEvaluationLogic(info, &EvaluationContext{Key: "user-1", Environment: "production"})
+			if got.Result != tt.wantResult || got.Reason.Kind != tt.wantReason {
+				t.Errorf("resultado %v (%s), esperado %v (%s)", got.Result, got.Reason.Kind, tt.wantResult, tt.wantReason)
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// RuleType define como um tipo de regra (Rule.Type) é validado e avaliado.
+// Para criar um tipo novo, basta registrá-lo em um init(), sem mexer no avaliador:
+//
+//	func init() {
+//		RegisterRuleType("WEEKDAY", RuleType{
+//			Validate: func(rule Rule) error { ... },
+//			Evaluate: func(e *evaluation, rule Rule) (bool, error) { ... },
+//		})
+//	}
+type RuleType struct {
+	// Validate confere o "schema" da regra (campos obrigatórios, valores
+	// válidos) ao salvá-la. Opcional: nil aceita qualquer regra do tipo.
+	Validate func(rule Rule) error
+	// Evaluate avalia a regra para o contexto da avaliação (e.evalCtx)
+	Evaluate func(e *evaluation, rule Rule) (bool, error)
+	// Compile prepara a forma tipada da regra (ver compile.go) uma única vez,
+	// quando a flag entra no cache em memória. Opcional. Retorna false se a
+	// regra não compila (ela então é avaliada sem a forma compilada).
+	Compile func(rule *Rule, compiled *compiledRule) bool
+}
+
+var (
+	ruleTypesMu sync.RWMutex
+	ruleTypes   = map[string]RuleType{}
+)
+
+// RegisterRuleType registra um tipo de regra. Registrar o mesmo tipo duas
+// vezes (ou sem Evaluate) é erro de programação, então gera panic.
+func RegisterRuleType(name string, ruleType RuleType) {
+	if name == "" || ruleType.Evaluate == nil {
+		panic(fmt.Sprintf("tipo de regra '%s' precisa de nome e de Evaluate", name))
+	}
+
+	ruleTypesMu.Lock()
+	defer ruleTypesMu.Unlock()
+	if _, exists := ruleTypes[name]; exists {
+		panic(fmt.Sprintf("tipo de regra '%s' registrado duas vezes", name))
+	}
+	ruleTypes[name] = ruleType
+}
+
+// lookupRuleType busca um tipo de regra no registro
+func lookupRuleType(name string) (RuleType, bool) {
+	ruleTypesMu.RLock()
+	defer ruleTypesMu.RUnlock()
+	ruleType, ok := ruleTypes[name]
+	return ruleType, ok
+}
+
+// Políticas para regras de tipo desconhecido (UNKNOWN_RULE_TYPE_POLICY),
+// ex: uma regra salva com um tipo que esta versão do serviço ainda não conhece
+const (
+	UnknownRuleFailClosed  = "fail_closed"  // flag desligada (padrão)
+	UnknownRuleFailOpen    = "fail_open"    // flag ligada, como se não houvesse regra
+	UnknownRuleFlagDefault = "flag_default" // resultado padrão (fallthrough) da flag
+)
+
+// parseUnknownRuleTypePolicy interpreta a UNKNOWN_RULE_TYPE_POLICY (vazia = fail_closed)
+func parseUnknownRuleTypePolicy(s string) (string, error) {
+	policy := strings.TrimSpace(s)
+	switch policy {
+	case "":
+		return UnknownRuleFailClosed, nil
+	case UnknownRuleFailClosed, UnknownRuleFailOpen, UnknownRuleFlagDefault:
+		return policy, nil
+	}
+	return "", fmt.Errorf("política desconhecida '%s' (use %s, %s ou %s)", s, UnknownRuleFailClosed, UnknownRuleFailOpen, UnknownRuleFlagDefault)
+}
+
+// ruleErrorDecision monta a decisão de uma flag cuja regra falhou ao ser avaliada.
+// Erros de configuração desligam a flag; um tipo de regra desconhecido segue a
+// UNKNOWN_RULE_TYPE_POLICY. O motivo é sempre ERROR, para o problema aparecer.
+func (a *App) ruleErrorDecision(e *evaluation, ruleSet RuleSet, err error) Decision {
+	reason := Reason{Kind: ReasonError, ErrorKind: errorKind(err)}
+
+	decision := Decision{Result: false}
+	if reason.ErrorKind == ErrorUnknownRuleType {
+		switch a.UnknownRulePolicy {
+		case UnknownRuleFailOpen:
+			decision = e.onDecision()
+		case UnknownRuleFlagDefault:
+			decision = e.outcomeDecision(ruleSet.Fallthrough)
+		}
+	}
+	decision.Reason = reason
+	return decision
+}
@@ -0,0 +1,328 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// evaluation carrega o estado da avaliação de uma flag para um contexto:
+// a flag, quem está sendo avaliado e as configurações do conjunto de regras
+type evaluation struct {
+	app         *App
+	flag        *Flag
+	evalCtx     *EvaluationContext
+	hashVersion int       // versão do hash de bucketing (ver bucketing.go)
+	now         time.Time // momento da avaliação (regras agendadas)
+	segmentPath []string  // segmentos sendo avaliados (detecta auto-referência)
+}
+
+// Tipos de regra embutidos. Cada tipo é avaliado (e validado) pela sua
+// entrada no registro (ver registry.go), e não por um switch no avaliador.
+func init() {
+	RegisterRuleType("AND", RuleType{Validate: validateLogicalRule, Evaluate: (*evaluation).evaluateAnd})
+	RegisterRuleType("OR", RuleType{Validate: validateLogicalRule, Evaluate: (*evaluation).evaluateOr})
+	RegisterRuleType("NOT", RuleType{Validate: validateLogicalRule, Evaluate: (*evaluation).evaluateNot})
+	RegisterRuleType("PERCENTAGE", RuleType{Validate: validatePercentageRule, Evaluate: (*evaluation).evaluatePercentage, Compile: compilePercentageRule})
+	RegisterRuleType("TIME_WINDOW", RuleType{Validate: validateTimeWindowRule, Evaluate: (*evaluation).inTimeWindow, Compile: compileScheduleRule})
+	RegisterRuleType("RAMP", RuleType{Validate: validateRampRule, Evaluate: (*evaluation).evaluateRamp, Compile: compileScheduleRule})
+	RegisterRuleType("USER_LIST", RuleType{Validate: validateUserListRule, Evaluate: (*evaluation).evaluateUserList})
+	RegisterRuleType("ATTRIBUTE", RuleType{Validate: validateAttributeRule, Evaluate: (*evaluation).evaluateAttribute, Compile: compileAttributeRule})
+	RegisterRuleType("SEGMENT", RuleType{Validate: validateSegmentRule, Evaluate: (*evaluation).evaluateSegment})
+	RegisterRuleType("BIG_SEGMENT", RuleType{Validate: validateBigSegmentRule, Evaluate: (*evaluation).evaluateBigSegment})
+	RegisterRuleType("CEL", RuleType{Validate: validateCELRule, Evaluate: (*evaluation).matchCEL, Compile: compileCELRule})
+}
+
+// evaluateRule avalia um nó da árvore de regras.
+// Nós AND/OR/NOT combinam os filhos em 'rules'; os demais tipos são folhas.
+func (e *evaluation) evaluateRule(rule Rule) (bool, error) {
+	// Lista de exclusão: usuários listados nunca atendem a este nó,
+	// independente do tipo da regra
+	if containsString(rule.Exclude, e.evalCtx.Key) {
+		return false, nil
+	}
+
+	// Regra compilada (ver compile.go): o tipo já foi resolvido
+	if rule.compiled != nil {
+		return rule.compiled.ruleType.Evaluate(e, rule)
+	}
+
+	ruleType, ok := lookupRuleType(rule.Type)
+	if !ok {
+		return false, &RuleError{Kind: ErrorUnknownRuleType, Msg: fmt.Sprintf("tipo de regra desconhecido '%s'", rule.Type)}
+	}
+	return ruleType.Evaluate(e, rule)
+}
+
+// evaluateAnd: todos os filhos devem ser atendidos (curto-circuito no primeiro 'false')
+func (e *evaluation) evaluateAnd(rule Rule) (bool, error) {
+	for _, child := range rule.Rules {
+		matched, err := e.evaluateRule(child)
+		if err != nil || !matched {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// evaluateOr: basta um filho ser atendido (curto-circuito no primeiro 'true')
+func (e *evaluation) evaluateOr(rule Rule) (bool, error) {
+	for _, child := range rule.Rules {
+		matched, err := e.evaluateRule(child)
+		if err != nil {
+			return false, err
+		}
+		if matched {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// evaluateNot inverte o resultado do único filho
+func (e *evaluation) evaluateNot(rule Rule) (bool, error) {
+	if len(rule.Rules) != 1 {
+		return false, newRuleError("regra NOT deve ter exatamente 1 filho (tem %d)", len(rule.Rules))
+	}
+	matched, err := e.evaluateRule(rule.Rules[0])
+	if err != nil {
+		return false, err
+	}
+	return !matched, nil
+}
+
+func (e *evaluation) evaluatePercentage(rule Rule) (bool, error) {
+	if rule.compiled != nil && rule.compiled.hasPercentage {
+		return e.inRollout(rule.compiled.percentage, rule.Bucketing), nil
+	}
+
+	// Converte o 'value' (que é interface{}) para float64
+	percentage, ok := rule.Value.(float64)
+	if !ok {
+		return false, newRuleError("valor da regra de porcentagem não é um número")
+	}
+
+	return e.inRollout(percentage, rule.Bucketing), nil
+}
+
+// evaluateRamp: porcentagem que cresce com o tempo (ver schedule.go)
+func (e *evaluation) evaluateRamp(rule Rule) (bool, error) {
+	percentage, err := e.rampPercentage(rule)
+	if err != nil {
+		return false, err
+	}
+	return e.inRollout(percentage, rule.Bucketing), nil
+}
+
+// evaluateUserList: lista explícita de usuários (ex: QA, beta testers)
+func (e *evaluation) evaluateUserList(rule Rule) (bool, error) {
+	return containsString(rule.Values, e.evalCtx.Key), nil
+}
+
+// evaluateAttribute: todas as cláusulas sobre os atributos do contexto devem ser atendidas
+func (e *evaluation) evaluateAttribute(rule Rule) (bool, error) {
+	return matchClauses(rule.Clauses, e.evalCtx, e.now)
+}
+
+// evaluateSegment: basta pertencer a um dos segmentos listados (ver segments.go)
+func (e *evaluation) evaluateSegment(rule Rule) (bool, error) {
+	return e.anyOf(rule.Values, e.inSegment)
+}
+
+// evaluateBigSegment: coortes grandes guardadas em SETs do Redis (ver bigsegments.go)
+func (e *evaluation) evaluateBigSegment(rule Rule) (bool, error) {
+	return e.anyOf(rule.Values, e.inBigSegment)
+}
+
+// anyOf retorna true se 'fn' for atendida para algum dos nomes
+func (e *evaluation) anyOf(names []string, fn func(name string) (bool, error)) (bool, error) {
+	for _, name := range names {
+		matched, err := fn(name)
+		if err != nil {
+			return false, err
+		}
+		if matched {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// --- Validação (schema) dos tipos embutidos ---
+
+// validateLogicalRule valida um nó AND/OR/NOT e, recursivamente, os seus filhos
+func validateLogicalRule(rule Rule) error {
+	if rule.Type == "NOT" && len(rule.Rules) != 1 {
+		return newRuleError("regra NOT deve ter exatamente 1 filho (tem %d)", len(rule.Rules))
+	}
+	if len(rule.Rules) == 0 {
+		return newRuleError("regra %s precisa de pelo menos 1 filho em 'rules'", rule.Type)
+	}
+	for _, child := range rule.Rules {
+		if err := validateRule(child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validatePercentageRule(rule Rule) error {
+	percentage, ok := rule.Value.(float64)
+	if !ok || percentage < 0 || percentage > 100 {
+		return newRuleError("valor da regra de porcentagem deve ser um número entre 0 e 100")
+	}
+	return nil
+}
+
+func validateTimeWindowRule(rule Rule) error {
+	start, end, err := parseSchedule(rule)
+	if err != nil {
+		return err
+	}
+	if start.IsZero() && end.IsZero() {
+		return newRuleError("regra TIME_WINDOW precisa de 'start' e/ou 'end'")
+	}
+	if !start.IsZero() && !end.IsZero() && !end.After(start) {
+		return newRuleError("regra TIME_WINDOW com 'end' antes de 'start'")
+	}
+	return nil
+}
+
+func validateRampRule(rule Rule) error {
+	start, end, err := parseSchedule(rule)
+	if err != nil {
+		return err
+	}
+	if start.IsZero() || end.IsZero() || !end.After(start) {
+		return newRuleError("regra RAMP precisa de 'start' e 'end', com 'end' depois de 'start'")
+	}
+	switch rule.Mode {
+	case "", "linear":
+	case "step":
+		if rule.Steps < 1 {
+			return newRuleError("regra RAMP com mode 'step' precisa de 'steps' >= 1")
+		}
+	default:
+		return newRuleError("mode de RAMP desconhecido '%s'", rule.Mode)
+	}
+	for _, percentage := range []float64{rule.From, rule.To} {
+		if percentage < 0 || percentage > 100 {
+			return newRuleError("'from' e 'to' da regra RAMP devem estar entre 0 e 100")
+		}
+	}
+	return nil
+}
+
+func validateUserListRule(rule Rule) error {
+	if len(rule.Values) == 0 {
+		return newRuleError("regra USER_LIST precisa de pelo menos 1 usuário em 'values'")
+	}
+	for _, key := range rule.Values {
+		if strings.TrimSpace(key) == "" {
+			return newRuleError("regra USER_LIST não aceita chaves de usuário vazias")
+		}
+	}
+	return nil
+}
+
+// Operadores que só comparam strings ou números. Na avaliação, um valor do
+// tipo errado simplesmente não casa; ao salvar, ele é rejeitado.
+var (
+	stringOnlyOperators = []string{"contains", "startsWith", "endsWith", "regex"}
+	numberOnlyOperators = []string{"greaterThan", "greaterThanOrEqual", "lessThan", "lessThanOrEqual"}
+)
+
+func validateAttributeRule(rule Rule) error {
+	if len(rule.Clauses) == 0 {
+		return newRuleError("regra ATTRIBUTE precisa de pelo menos 1 cláusula")
+	}
+	for _, clause := range rule.Clauses {
+		if clause.Attribute == "" || len(clause.Values) == 0 {
+			return newRuleError("cláusula precisa de 'attribute' e de pelo menos 1 valor em 'values'")
+		}
+		// O próprio matchOperator rejeita operadores desconhecidos e valores
+		// inválidos (regex, versões, CIDRs), um valor de cada vez
+		for _, value := range clause.Values {
+			if _, isString := value.(string); !isString && containsString(stringOnlyOperators, clause.Operator) {
+				return newRuleError("operador '%s' aceita apenas strings em 'values' (recebeu %v)", clause.Operator, value)
+			}
+			if _, isNumber := toFloat(value); !isNumber && containsString(numberOnlyOperators, clause.Operator) {
+				return newRuleError("operador '%s' aceita apenas números em 'values' (recebeu %v)", clause.Operator, value)
+			}
+			if _, err := matchOperator(clause.Operator, "", []interface{}{value}, nil, time.Time{}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func validateSegmentRule(rule Rule) error {
+	if len(rule.Values) == 0 {
+		return newRuleError("regra SEGMENT precisa de pelo menos 1 segmento em 'values'")
+	}
+	return nil
+}
+
+func validateBigSegmentRule(rule Rule) error {
+	if len(rule.Values) == 0 {
+		return newRuleError("regra BIG_SEGMENT precisa de pelo menos 1 big segment em 'values'")
+	}
+	for _, name := range rule.Values {
+		if !bigSegmentNamePattern.MatchString(name) {
+			return newRuleError("nome de big segment inválido '%s'", name)
+		}
+	}
+	return nil
+}
+
+// inRollout verifica se o contexto está dentro da porcentagem
+func (e *evaluation) inRollout(percentage float64, bucketing Bucketing) bool {
+	// Sem o atributo de bucketing (ex: 'org_id'), o contexto fica fora do rollout
+	key, ok := e.bucketKey(bucketing)
+	if !ok {
+		return false
+	}
+
+	// Calcula o "bucket" do usuário (0-99999) e compara com a porcentagem
+	// na mesma escala (ex: 0.5% = bucket < 500)
+	userBucket := getBucket(key+e.flag.Name+bucketing.Salt, e.hashVersion)
+	return userBucket < percentageThreshold(percentage)
+}
+
+// bucketKey retorna a chave usada no hash: o 'bucket_by' do contexto, ou a
+// própria chave do contexto se não houver 'bucket_by'
+func (e *evaluation) bucketKey(b Bucketing) (string, bool) {
+	if b.BucketBy == "" {
+		return e.evalCtx.Key, true
+	}
+	value, found := e.evalCtx.attribute(b.BucketBy)
+	if !found {
+		return "", false
+	}
+	switch v := value.(type) {
+	case string:
+		return v, v != ""
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	}
+	return "", false
+}
+
+// percentageThreshold converte uma porcentagem (0-100) para a escala dos buckets.
+// O arredondamento evita erros de ponto flutuante (ex: 0.7 * 1000 = 700.0000000000001).
+func percentageThreshold(percentage float64) int {
+	return int(math.Round(percentage * BucketScale / 100))
+}
+
+// containsString verifica se 'value' está presente na lista
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"math"
+	"time"
+	_ "time/tzdata" // Embute o banco de fusos horários (a imagem alpine não tem)
+)
+
+// Formatos aceitos em 'start' e 'end'. Sem offset, o horário é
+// interpretado no fuso da regra ('timezone', padrão UTC).
+var scheduleTimeLayouts = []string{
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// inTimeWindow verifica se o momento da avaliação está em [start, end).
+// 'start' ou 'end' vazios deixam a janela aberta daquele lado.
+func (e *evaluation) inTimeWindow(rule Rule) (bool, error) {
+	start, end, err := parseSchedule(rule)
+	if err != nil {
+		return false, err
+	}
+	if start.IsZero() && end.IsZero() {
+		return false, newRuleError("regra TIME_WINDOW precisa de 'start' e/ou 'end'")
+	}
+
+	if !start.IsZero() && e.now.Before(start) {
+		return false, nil
+	}
+	if !end.IsZero() && !e.now.Before(end) {
+		return false, nil
+	}
+	return true, nil
+}
+
+// rampPercentage calcula a porcentagem atual de uma regra RAMP, que vai de
+// 'from' (em 'start') até 'to' (em 'end'):
+//   - "linear" (padrão): cresce continuamente
+//   - "step": cresce em 'steps' degraus iguais
+func (e *evaluation) rampPercentage(rule Rule) (float64, error) {
+	start, end, err := parseSchedule(rule)
+	if err != nil {
+		return 0, err
+	}
+	if start.IsZero() || end.IsZero() || !end.After(start) {
+		return 0, newRuleError("regra RAMP precisa de 'start' e 'end', com 'end' depois de 'start'")
+	}
+
+	// Antes do início e depois do fim, valem os extremos
+	if e.now.Before(start) {
+		return rule.From, nil
+	}
+	if !e.now.Before(end) {
+		return rule.To, nil
+	}
+
+	progress := float64(e.now.Sub(start)) / float64(end.Sub(start))
+	switch rule.Mode {
+	case "", "linear":
+		// nada a fazer: progresso contínuo
+	case "step":
+		if rule.Steps < 1 {
+			return 0, newRuleError("regra RAMP com mode 'step' precisa de 'steps' >= 1")
+		}
+		progress = math.Floor(progress*float64(rule.Steps)) / float64(rule.Steps)
+	default:
+		return 0, newRuleError("mode de RAMP desconhecido '%s'", rule.Mode)
+	}
+
+	return rule.From + (rule.To-rule.From)*progress, nil
+}
+
+// parseSchedule converte 'start' e 'end' da regra no fuso 'timezone'
+// (ou usa os já convertidos, se a regra estiver compilada)
+func parseSchedule(rule Rule) (time.Time, time.Time, error) {
+	if rule.compiled != nil && rule.compiled.hasSchedule {
+		return rule.compiled.start, rule.compiled.end, nil
+	}
+
+	loc := time.UTC
+	if rule.Timezone != "" {
+		var err error
+		loc, err = time.LoadLocation(rule.Timezone)
+		if err != nil {
+			return time.Time{}, time.Time{}, newRuleError("timezone inválido '%s'", rule.Timezone)
+		}
+	}
+
+	start, err := parseScheduleTime(rule.Start, loc)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	end, err := parseScheduleTime(rule.End, loc)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	return start, end, nil
+}
+
+// parseScheduleTime aceita RFC 3339 (com offset) ou data/hora local no fuso 'loc'.
+// String vazia retorna o tempo zero (sem limite).
+func parseScheduleTime(value string, loc *time.Location) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	for _, layout := range scheduleTimeLayouts {
+		if t, err := time.ParseInLocation(layout, value, loc); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, newRuleError("data/hora inválida '%s'", value)
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+)
+
+// segmentCacheKey é a chave do Redis com um Segment do ambiente
+func segmentCacheKey(environment, name string) string {
+	return fmt.Sprintf("segment_info:%s:%s", environment, name)
+}
+
+// getSegment busca um segmento no Redis, com fallback para o targeting-service
+// (mesmo esquema do getCombinedFlagInfo)
+func (a *App) getSegment(environment, name string) (*Segment, error) {
+	cacheKey := segmentCacheKey(environment, name)
+
+	// 1. Tentar buscar do Cache (Redis)
+	val, err := a.RedisClient.Get(ctx, cacheKey).Result()
+	if err == nil {
+		// Cache HIT: se o payload não mudou, usa o segmento já compilado em
+		// memória (sem desserializar de novo, ver compile.go)
+		segment, err := getCompiledSegment(cacheKey, val)
+		if err == nil {
+			return segment, nil
+		}
+		log.Printf("Erro ao desserializar cache para segmento '%s': %v", name, err)
+	}
+
+	log.Printf("Cache MISS para segmento '%s'", name)
+	// 2. Cache MISS - Buscar do targeting-service
+	segment, err := a.fetchSegment(environment, name)
+	if err != nil {
+		return nil, err
+	}
+
+	// 3. Salvar no Cache (e a versão compilada em memória)
+	jsonData, err := json.Marshal(segment)
+	if err == nil {
+		a.RedisClient.Set(ctx, cacheKey, jsonData, CACHE_TTL).Err()
+		storeCompiledSegment(cacheKey, string(jsonData), segment)
+	}
+
+	return segment, nil
+}
+
+// fetchSegment (função helper)
+func (a *App) fetchSegment(environment, name string) (*Segment, error) {
+	url := fmt.Sprintf("%s/segments/%s?%s", a.TargetingServiceURL, name, environmentQuery(environment))
+	apiKey := os.Getenv("SERVICE_API_KEY")
+	req, _ := http.NewRequest("GET", url, nil)
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+
+	resp, err := a.HttpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao chamar targeting-service: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, &NotFoundError{name}
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("targeting-service retornou status %d", resp.StatusCode)
+	}
+
+	body, _ := ioutil.ReadAll(resp.Body)
+	var segment Segment
+	if err := json.Unmarshal(body, &segment); err != nil {
+		return nil, fmt.Errorf("erro ao desserializar resposta do targeting-service: %w", err)
+	}
+	return &segment, nil
+}
+
+// inSegment verifica se o contexto pertence ao segmento:
+// 'excluded' vence tudo, depois 'included', depois QUALQUER uma das regras
+func (e *evaluation) inSegment(name string) (bool, error) {
+	// Segmento que (indiretamente) referencia a si mesmo
+	if containsString(e.segmentPath, name) {
+		return false, newRuleError("segmento '%s' referencia a si mesmo", name)
+	}
+
+	// Segmentos são sempre do mesmo ambiente da flag
+	segment, err := e.app.getSegment(e.evalCtx.Environment, name)
+	if err != nil {
+		if _, ok := err.(*NotFoundError); ok {
+			return false, &RuleError{Kind: ErrorSegmentNotFound, Msg: fmt.Sprintf("segmento '%s' não encontrado", name)}
+		}
+		return false, &RuleError{Kind: ErrorServiceUnavailable, Msg: err.Error()}
+	}
+
+	if containsString(segment.Excluded, e.evalCtx.Key) {
+		return false, nil
+	}
+	if containsString(segment.Included, e.evalCtx.Key) {
+		return true, nil
+	}
+
+	e.segmentPath = append(e.segmentPath, name)
+	defer func() { e.segmentPath = e.segmentPath[:len(e.segmentPath)-1] }()
+
+	for _, rule := range segment.Rules {
+		matched, err := e.evaluateRule(rule)
+		if err != nil {
+			return false, err
+		}
+		if matched {
+			return true, nil
+		}
+	}
+	return false, nil
+}
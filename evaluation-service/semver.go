@@ -0,0 +1,386 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+)
+
+// semver é uma versão semântica (https://semver.org). Metadados de build
+// ('+...') são ignorados, pois não afetam a precedência.
+type semver struct {
+	major, minor, patch int
+	pre                 []string // identificadores do pre-release (ex: "beta.2" -> ["beta", "2"])
+}
+
+// semverComparator é uma comparação simples (ex: ">=4.12.0") de um intervalo
+type semverComparator struct {
+	op      string // "=", ">", ">=", "<" ou "<="
+	version semver
+}
+
+// parseSemver interpreta uma versão completa ("4.12.0", "v4.12.0-beta.1").
+// Versões parciais ("4.12") são completadas com zeros, já que muitos apps
+// reportam só major.minor.
+func parseSemver(s string) (semver, bool) {
+	v, n, ok := parsePartialSemver(s)
+	if !ok || n == 0 {
+		return semver{}, false
+	}
+	return v, true
+}
+
+// parsePartialSemver interpreta uma versão que pode ser parcial ou ter
+// curingas ("4", "4.12", "4.x", "*"). Retorna também quantas partes
+// (major, minor, patch) foram informadas.
+func parsePartialSemver(s string) (semver, int, bool) {
+	s = strings.TrimPrefix(strings.TrimPrefix(strings.TrimSpace(s), "="), "v")
+	if i := strings.Index(s, "+"); i >= 0 {
+		s = s[:i]
+	}
+
+	var v semver
+	if i := strings.Index(s, "-"); i >= 0 {
+		v.pre = strings.Split(s[i+1:], ".")
+		for _, id := range v.pre {
+			if id == "" {
+				return semver{}, 0, false
+			}
+		}
+		s = s[:i]
+	}
+	if s == "" {
+		return semver{}, 0, false
+	}
+
+	parts := strings.Split(s, ".")
+	if len(parts) > 3 {
+		return semver{}, 0, false
+	}
+	fields := []*int{&v.major, &v.minor, &v.patch}
+	n := 0
+	for _, part := range parts {
+		if part == "x" || part == "X" || part == "*" {
+			break
+		}
+		num, err := strconv.Atoi(part)
+		if err != nil || num < 0 {
+			return semver{}, 0, false
+		}
+		*fields[n] = num
+		n++
+	}
+	// Pre-release só faz sentido em uma versão completa
+	if v.pre != nil && n < 3 {
+		return semver{}, 0, false
+	}
+	return v, n, true
+}
+
+// compareSemver retorna -1, 0 ou 1 seguindo a precedência do semver:
+// major, minor e patch numericamente, e uma versão com pre-release é
+// menor que a mesma versão sem (4.12.0-beta < 4.12.0)
+func compareSemver(a, b semver) int {
+	for _, d := range []int{a.major - b.major, a.minor - b.minor, a.patch - b.patch} {
+		if d < 0 {
+			return -1
+		}
+		if d > 0 {
+			return 1
+		}
+	}
+
+	switch {
+	case len(a.pre) == 0 && len(b.pre) == 0:
+		return 0
+	case len(a.pre) == 0:
+		return 1
+	case len(b.pre) == 0:
+		return -1
+	}
+
+	for i := 0; i < len(a.pre) && i < len(b.pre); i++ {
+		if c := comparePrereleaseID(a.pre[i], b.pre[i]); c != 0 {
+			return c
+		}
+	}
+	switch {
+	case len(a.pre) < len(b.pre):
+		return -1
+	case len(a.pre) > len(b.pre):
+		return 1
+	}
+	return 0
+}
+
+// comparePrereleaseID compara um identificador do pre-release: numéricos
+// como números, e sempre menores que os alfanuméricos
+func comparePrereleaseID(a, b string) int {
+	numA, errA := strconv.Atoi(a)
+	numB, errB := strconv.Atoi(b)
+	switch {
+	case errA == nil && errB == nil:
+		switch {
+		case numA < numB:
+			return -1
+		case numA > numB:
+			return 1
+		}
+		return 0
+	case errA == nil:
+		return -1
+	case errB == nil:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+// compareSemverValues aplica 'fn' ao resultado de compareSemver.
+// Um atributo que não é uma versão válida simplesmente não casa, mas um
+// valor inválido na cláusula é erro de configuração da regra.
+func compareSemverValues(attrValue, value interface{}, fn func(c int) bool) (bool, error) {
+	str, ok := value.(string)
+	if !ok {
+		return false, newRuleError("versão inválida na cláusula: %v", value)
+	}
+	want, ok := parseSemver(str)
+	if !ok {
+		return false, newRuleError("versão inválida na cláusula: '%s'", str)
+	}
+
+	attrString, ok := attrValue.(string)
+	if !ok {
+		return false, nil
+	}
+	got, ok := parseSemver(attrString)
+	if !ok {
+		return false, nil
+	}
+	return fn(compareSemver(got, want)), nil
+}
+
+// matchSemverRange verifica se o atributo satisfaz um intervalo no estilo
+// do npm, ex: ">=4.12.0 <5", "^4.12", "~4.12.1", "4.x", "1.2 - 2.3" ou
+// vários conjuntos separados por "||".
+func matchSemverRange(attrValue, value interface{}) (bool, error) {
+	str, ok := value.(string)
+	if !ok {
+		return false, newRuleError("intervalo de versões inválido na cláusula: %v", value)
+	}
+	sets, err := parseSemverRange(str)
+	if err != nil {
+		return false, err
+	}
+
+	attrString, ok := attrValue.(string)
+	if !ok {
+		return false, nil
+	}
+	version, ok := parseSemver(attrString)
+	if !ok {
+		return false, nil
+	}
+
+	for _, set := range sets {
+		if semverSetMatches(set, version) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// semverSetMatches verifica um conjunto de comparações (todas devem ser atendidas).
+// Como no npm, uma versão pre-release só é aceita se alguma comparação do
+// conjunto tiver um pre-release do mesmo major.minor.patch: ">=4.12.0-beta"
+// aceita "4.12.0-rc.1", mas ">=4.12.0" não aceita "4.13.0-beta".
+func semverSetMatches(set []semverComparator, v semver) bool {
+	for _, c := range set {
+		cmp := compareSemver(v, c.version)
+		var ok bool
+		switch c.op {
+		case "=":
+			ok = cmp == 0
+		case ">":
+			ok = cmp > 0
+		case ">=":
+			ok = cmp >= 0
+		case "<":
+			ok = cmp < 0
+		case "<=":
+			ok = cmp <= 0
+		}
+		if !ok {
+			return false
+		}
+	}
+
+	if len(v.pre) == 0 {
+		return true
+	}
+	for _, c := range set {
+		cv := c.version
+		if len(cv.pre) > 0 && cv.major == v.major && cv.minor == v.minor && cv.patch == v.patch {
+			return true
+		}
+	}
+	return false
+}
+
+// parseSemverRange converte um intervalo em conjuntos de comparações simples
+// (basta um conjunto ser atendido)
+func parseSemverRange(s string) ([][]semverComparator, error) {
+	var sets [][]semverComparator
+	for _, part := range strings.Split(s, "||") {
+		tokens := strings.Fields(part)
+		// Um conjunto vazio (ex: "", "4.x || ") aceitaria qualquer versão; use "*"
+		if len(tokens) == 0 {
+			return nil, newRuleError("intervalo de versões vazio: '%s'", s)
+		}
+
+		// Operadores separados da versão (ex: ">= 4.12") são juntados
+		var joined []string
+		for i := 0; i < len(tokens); i++ {
+			if isSemverOperator(tokens[i]) && i+1 < len(tokens) {
+				joined = append(joined, tokens[i]+tokens[i+1])
+				i++
+				continue
+			}
+			joined = append(joined, tokens[i])
+		}
+
+		var set []semverComparator
+		for i := 0; i < len(joined); i++ {
+			// Intervalo com hífen: "1.2.3 - 2.3.4"
+			if i+2 < len(joined) && joined[i+1] == "-" {
+				lower, err := expandSemverComparator(">=", joined[i])
+				if err != nil {
+					return nil, err
+				}
+				upper, err := expandSemverComparator("<=", joined[i+2])
+				if err != nil {
+					return nil, err
+				}
+				set = append(set, lower...)
+				set = append(set, upper...)
+				i += 2
+				continue
+			}
+
+			op, version := splitSemverOperator(joined[i])
+			comparators, err := expandSemverComparator(op, version)
+			if err != nil {
+				return nil, err
+			}
+			set = append(set, comparators...)
+		}
+		sets = append(sets, set)
+	}
+	return sets, nil
+}
+
+// Operadores aceitos nos intervalos (os de 2 caracteres primeiro)
+var semverOperators = []string{">=", "<=", ">", "<", "=", "^", "~"}
+
+func isSemverOperator(token string) bool {
+	return containsString(semverOperators, token)
+}
+
+// splitSemverOperator separa o operador da versão (ex: ">=4.12" -> ">=", "4.12")
+func splitSemverOperator(token string) (string, string) {
+	for _, op := range semverOperators {
+		if strings.HasPrefix(token, op) {
+			return op, token[len(op):]
+		}
+	}
+	return "=", token
+}
+
+// expandSemverComparator converte um comparador (que pode ter versão parcial,
+// '^' ou '~') em comparações simples
+func expandSemverComparator(op, s string) ([]semverComparator, error) {
+	v, n, ok := parsePartialSemver(s)
+	if !ok {
+		return nil, newRuleError("versão inválida no intervalo: '%s'", s)
+	}
+
+	// Limites: 'lowest(x)' é a menor versão possível de x (x-0), usada nos
+	// limites superiores exclusivos para não deixar passar pre-releases
+	lowest := func(major, minor, patch int) semver {
+		return semver{major: major, minor: minor, patch: patch, pre: []string{"0"}}
+	}
+	gte := func(version semver) semverComparator { return semverComparator{">=", version} }
+	lt := func(version semver) semverComparator { return semverComparator{"<", version} }
+	none := []semverComparator{lt(lowest(0, 0, 0))}
+
+	switch op {
+	case "=":
+		switch n {
+		case 0:
+			return nil, nil
+		case 1:
+			return []semverComparator{gte(v), lt(lowest(v.major+1, 0, 0))}, nil
+		case 2:
+			return []semverComparator{gte(v), lt(lowest(v.major, v.minor+1, 0))}, nil
+		}
+		return []semverComparator{{"=", v}}, nil
+
+	case ">":
+		switch n {
+		case 0:
+			return none, nil
+		case 1:
+			return []semverComparator{gte(semver{major: v.major + 1})}, nil
+		case 2:
+			return []semverComparator{gte(semver{major: v.major, minor: v.minor + 1})}, nil
+		}
+		return []semverComparator{{">", v}}, nil
+
+	case ">=":
+		if n == 0 {
+			return nil, nil
+		}
+		return []semverComparator{gte(v)}, nil
+
+	case "<":
+		switch n {
+		case 0:
+			return none, nil
+		case 1, 2:
+			return []semverComparator{lt(lowest(v.major, v.minor, 0))}, nil
+		}
+		return []semverComparator{lt(v)}, nil
+
+	case "<=":
+		switch n {
+		case 0:
+			return nil, nil
+		case 1:
+			return []semverComparator{lt(lowest(v.major+1, 0, 0))}, nil
+		case 2:
+			return []semverComparator{lt(lowest(v.major, v.minor+1, 0))}, nil
+		}
+		return []semverComparator{{"<=", v}}, nil
+
+	case "~":
+		// Permite mudanças de patch (ou de minor, se só o major foi informado)
+		switch n {
+		case 0:
+			return nil, nil
+		case 1:
+			return []semverComparator{gte(v), lt(lowest(v.major+1, 0, 0))}, nil
+		}
+		return []semverComparator{gte(v), lt(lowest(v.major, v.minor+1, 0))}, nil
+
+	case "^":
+		// Permite mudanças que não alteram o primeiro número diferente de zero
+		switch {
+		case n == 0:
+			return nil, nil
+		case v.major > 0 || n == 1:
+			return []semverComparator{gte(v), lt(lowest(v.major+1, 0, 0))}, nil
+		case v.minor > 0 || n == 2:
+			return []semverComparator{gte(v), lt(lowest(0, v.minor+1, 0))}, nil
+		}
+		return []semverComparator{gte(v), lt(lowest(0, 0, v.patch+1))}, nil
+	}
+	return nil, newRuleError("operador de versão desconhecido '%s'", op)
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// rangeMatches avalia um intervalo como o matchSemverRange: basta um conjunto ser atendido
+func rangeMatches(t *testing.T, r, version string) bool {
+	t.Helper()
+	sets, err := parseSemverRange(r)
+	if err != nil {
+		t.Fatalf("parseSemverRange(%q): %v", r, err)
+	}
+	v, ok := parseSemver(version)
+	if !ok {
+		t.Fatalf("versão inválida no teste: %q", version)
+	}
+	for _, set := range sets {
+		if semverSetMatches(set, v) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestSemverRange(t *testing.T) {
+	tests := []struct {
+		rng     string
+		version string
+		want    bool
+	}{
+		// Comparações simples (numéricas, não lexicográficas)
+		{">=4.12.0 <5", "4.12.0", true},
+		{">=4.12.0 <5", "4.99.1", true},
+		{">=4.12.0 <5", "4.9.0", false},
+		{">=4.12.0 <5", "5.0.0", false},
+		{">= 4.12", "4.12.0", true},
+		{"<4.12", "4.9.7", true},
+		{"4.12.1", "4.12.1", true},
+		{"4.12.1", "4.12.2", false},
+
+		// Atalhos do npm
+		{"^4.12", "4.12.0", true},
+		{"^4.12", "4.13.5", true},
+		{"^4.12", "4.11.9", false},
+		{"^4.12", "5.0.0", false},
+		{"~4.12.1", "4.12.9", true},
+		{"~4.12.1", "4.13.0", false},
+		{"4.x", "4.0.0", true},
+		{"4.x", "5.0.0", false},
+		{"*", "0.0.1", true},
+		{"1.2 - 2.3", "1.2.0", true},
+		{"1.2 - 2.3", "2.3.9", true},
+		{"1.2 - 2.3", "2.4.0", false},
+		{"1.2 - 2.3", "1.1.9", false},
+
+		// Vários conjuntos
+		{"<4 || >=6", "3.9.9", true},
+		{"<4 || >=6", "5.0.0", false},
+		{"<4 || >=6", "6.0.0", true},
+
+		// Pre-release: só casa se o intervalo citar um pre-release da mesma versão
+		{">=4.12.0", "4.13.0-beta", false},
+		{">=4.13.0-beta", "4.13.0-rc.1", true},
+		{">=4.13.0-beta", "4.13.0-alpha", false},
+		{">=4.13.0-beta", "4.14.0-beta", false},
+		{">=4.13.0-beta", "4.14.0", true},
+		{"^4.12", "4.13.0-beta", false},
+		{"^4.12", "5.0.0-beta", false},
+		{"*", "1.0.0-beta", false},
+		{"<4.13.0", "4.13.0-rc.1", false},
+	}
+
+	for _, tt := range tests {
+		if got := rangeMatches(t, tt.rng, tt.version); got != tt.want {
+			t.Errorf("%q em %q: %v, esperado %v", tt.version, tt.rng, got, tt.want)
+		}
+	}
+}
+
+func TestSemverRangeMalformed(t *testing.T) {
+	ranges := []string{
+		"",
+		"   ",
+		"4.x || ",
+		"|| 4.x",
+		">=",
+		"banana",
+		">=4.12.0 <",
+		"1.2.3.4",
+	}
+
+	for _, r := range ranges {
+		if _, err := parseSemverRange(r); err == nil {
+			t.Errorf("parseSemverRange(%q): esperado erro", r)
+		}
+		// A validação da regra (ao salvar) rejeita o mesmo intervalo
+		rule := Rule{Type: "ATTRIBUTE", Clauses: []Clause{{Attribute: "app_version", Operator: "semverRange", Values: []interface{}{r}}}}
+		err := validateAttributeRule(rule)
+		if err == nil || errorKind(err) != ErrorMalformedRule {
+			t.Errorf("validateAttributeRule(%q): %v, esperado MALFORMED_RULE", r, err)
+		}
+	}
+}
+
+// Um atributo que não é uma versão nunca casa (e não é erro da regra)
+func TestSemverAttributeNotAVersion(t *testing.T) {
+	for _, attr := range []interface{}{"N/A", "", 4.12, nil} {
+		ok, err := matchOperator("semverGte", attr, []interface{}{"4.12.0"}, nil, time.Time{})
+		if ok || err != nil {
+			t.Errorf("semverGte com atributo %#v: %v, %v", attr, ok, err)
+		}
+	}
+}
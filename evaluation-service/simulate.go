@@ -0,0 +1,240 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+)
+
+// Máximo de usuários (ou amostra sintética) por simulação
+const simulationMaxUsers = 250000
+
+// SimulationRequest é o corpo do POST /admin/simulate
+type SimulationRequest struct {
+	FlagName     string              `json:"flag_name"`
+	ProposedRule json.RawMessage     `json:"proposed_rule"`          // TargetingRule proposta (is_enabled padrão: true)
+	CurrentRule  json.RawMessage     `json:"current_rule,omitempty"` // ausente = regra atual da flag; null = sem regra
+	Users        []string            `json:"users,omitempty"`        // chaves de usuário, sem atributos
+	Contexts     []EvaluationContext `json:"contexts,omitempty"`     // contextos completos
+	SampleSize   int                 `json:"sample_size,omitempty"`  // amostra sintética de chaves
+}
+
+// SimulationSummary é a distribuição dos resultados de uma das regras
+type SimulationSummary struct {
+	True       int            `json:"true"`
+	False      int            `json:"false"`
+	Variations map[string]int `json:"variations,omitempty"`
+	Reasons    map[string]int `json:"reasons"`
+}
+
+// SimulationOutcome é o resultado de um usuário em uma das regras
+type SimulationOutcome struct {
+	Result    bool   `json:"result"`
+	Variation string `json:"variation,omitempty"`
+	Reason    Reason `json:"reason"`
+}
+
+// SimulationChange é um usuário cujo resultado (ou variação) muda
+type SimulationChange struct {
+	Key      string            `json:"key"`
+	Current  SimulationOutcome `json:"current"`
+	Proposed SimulationOutcome `json:"proposed"`
+}
+
+// SimulationResponse é a resposta do POST /admin/simulate
+type SimulationResponse struct {
+	FlagName     string             `json:"flag_name"`
+	Environment  string             `json:"environment"`
+	Total        int                `json:"total"`
+	Current      SimulationSummary  `json:"current"`
+	Proposed     SimulationSummary  `json:"proposed"`
+	ChangedCount int                `json:"changed_count"`
+	Changed      []SimulationChange `json:"changed"`
+}
+
+// simulateHandler compara a regra atual (ou uma informada) com uma regra
+// proposta para uma lista de usuários, sem salvar nada e sem enviar eventos.
+// As duas regras passam pelo MESMO runEvaluationLogic das avaliações reais
+// (kill switch, overrides, holdout, camadas, pré-requisitos...).
+func (a *App) simulateHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodPost {
+		http.Error(w, `{"error": "Método não permitido"}`, http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req SimulationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error": "Corpo JSON inválido"}`, http.StatusBadRequest)
+		return
+	}
+	if req.FlagName == "" || len(req.ProposedRule) == 0 {
+		http.Error(w, `{"error": "flag_name e proposed_rule são obrigatórios"}`, http.StatusBadRequest)
+		return
+	}
+
+	environment, ok := a.requestEnvironment(w, r)
+	if !ok {
+		return
+	}
+
+	// 1. Montar os contextos a simular
+	contexts, err := simulationContexts(req)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error": "%s"}`, jsonEscape(err.Error())), http.StatusBadRequest)
+		return
+	}
+
+	// 2. Buscar a flag (variações, kill switch, overrides) e montar as duas versões
+	info, err := a.getCombinedFlagInfo(environment, req.FlagName)
+	if err != nil {
+		if _, ok := err.(*NotFoundError); ok {
+			http.Error(w, `{"error": "Flag não encontrada"}`, http.StatusNotFound)
+			return
+		}
+		log.Printf("Erro ao buscar flag '%s' para simulação: %v", req.FlagName, err)
+		http.Error(w, `{"error": "Erro interno ao buscar a flag"}`, http.StatusBadGateway)
+		return
+	}
+
+	proposed, err := decodeProposedRule(req.ProposedRule, info.Rule)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error": "proposed_rule inválida: %s"}`, jsonEscape(err.Error())), http.StatusBadRequest)
+		return
+	}
+	current := info.Rule
+	if len(req.CurrentRule) > 0 {
+		if current, err = decodeSimulationRule(req.CurrentRule); err != nil {
+			http.Error(w, fmt.Sprintf(`{"error": "current_rule inválida: %s"}`, jsonEscape(err.Error())), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// As regras recebidas no corpo também são compiladas (são avaliadas para
+	// até simulationMaxUsers usuários); a atual já vem compilada do cache
+	if proposed != nil {
+		compileRuleSet(&proposed.Rules)
+	}
+	if current != nil && current != info.Rule {
+		compileRuleSet(&current.Rules)
+	}
+
+	currentInfo := &CombinedFlagInfo{Flag: info.Flag, Rule: current, Overrides: info.Overrides}
+	proposedInfo := &CombinedFlagInfo{Flag: info.Flag, Rule: proposed, Overrides: info.Overrides}
+
+	// 3. Avaliar cada contexto com as duas regras
+	response := SimulationResponse{
+		FlagName:    req.FlagName,
+		Environment: environment,
+		Total:       len(contexts),
+		Current:     newSimulationSummary(),
+		Proposed:    newSimulationSummary(),
+		Changed:     []SimulationChange{},
+	}
+	for i := range contexts {
+		evalCtx := &contexts[i]
+		evalCtx.Environment = environment
+
+		before := a.runEvaluationLogic(currentInfo, evalCtx)
+		after := a.runEvaluationLogic(proposedInfo, evalCtx)
+		response.Current.add(before)
+		response.Proposed.add(after)
+
+		if before.Result != after.Result || before.Variation != after.Variation {
+			response.Changed = append(response.Changed, SimulationChange{
+				Key:      evalCtx.Key,
+				Current:  SimulationOutcome{Result: before.Result, Variation: before.Variation, Reason: before.Reason},
+				Proposed: SimulationOutcome{Result: after.Result, Variation: after.Variation, Reason: after.Reason},
+			})
+		}
+	}
+	response.ChangedCount = len(response.Changed)
+
+	// 4. Retornar a resposta
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// simulationContexts monta os contextos a partir de 'contexts', 'users' ou 'sample_size'
+func simulationContexts(req SimulationRequest) ([]EvaluationContext, error) {
+	if len(req.Contexts) > simulationMaxUsers || len(req.Users) > simulationMaxUsers || req.SampleSize > simulationMaxUsers {
+		return nil, fmt.Errorf("no máximo %d usuários por simulação", simulationMaxUsers)
+	}
+
+	var contexts []EvaluationContext
+	switch {
+	case len(req.Contexts) > 0:
+		contexts = req.Contexts
+	case len(req.Users) > 0:
+		contexts = make([]EvaluationContext, len(req.Users))
+		for i, key := range req.Users {
+			contexts[i].Key = key
+		}
+	case req.SampleSize > 0:
+		contexts = make([]EvaluationContext, req.SampleSize)
+		for i := range contexts {
+			contexts[i].Key = fmt.Sprintf("sim-user-%d", i)
+		}
+	default:
+		return nil, fmt.Errorf("informe users, contexts ou sample_size")
+	}
+
+	for _, evalCtx := range contexts {
+		if evalCtx.Key == "" {
+			return nil, fmt.Errorf("todos os usuários precisam de uma chave")
+		}
+	}
+	return contexts, nil
+}
+
+// decodeSimulationRule interpreta uma TargetingRule da simulação.
+// 'null' significa "sem regra"; sem 'is_enabled', a regra vale como ativa.
+func decodeSimulationRule(raw json.RawMessage) (*TargetingRule, error) {
+	if string(raw) == "null" {
+		return nil, nil
+	}
+	rule := &TargetingRule{IsEnabled: true}
+	if err := json.Unmarshal(raw, rule); err != nil {
+		return nil, err
+	}
+	return rule, nil
+}
+
+// decodeProposedRule interpreta a regra proposta com a mesma 'hash_version'
+// que ela teria ao ser salva no targeting-service: a da regra atual (um PUT
+// mantém a versão) ou, para uma regra nova, HashVersionHighRes. Sem isso, a
+// simulação usaria os buckets da v1 e não descreveria a regra salva.
+func decodeProposedRule(raw json.RawMessage, saved *TargetingRule) (*TargetingRule, error) {
+	rule, err := decodeSimulationRule(raw)
+	if err != nil || rule == nil || rule.Rules.HashVersion != 0 {
+		return rule, err
+	}
+	switch {
+	case saved == nil:
+		rule.Rules.HashVersion = HashVersionHighRes
+	case saved.Rules.HashVersion == 0:
+		rule.Rules.HashVersion = HashVersionLegacy
+	default:
+		rule.Rules.HashVersion = saved.Rules.HashVersion
+	}
+	return rule, nil
+}
+
+func newSimulationSummary() SimulationSummary {
+	return SimulationSummary{Variations: map[string]int{}, Reasons: map[string]int{}}
+}
+
+// add contabiliza uma decisão na distribuição
+func (s *SimulationSummary) add(decision Decision) {
+	if decision.Result {
+		s.True++
+	} else {
+		s.False++
+	}
+	if decision.Variation != "" {
+		s.Variations[decision.Variation]++
+	}
+	s.Reasons[decision.Reason.Kind]++
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+)
+
+func decodeTargetingRule(t *testing.T, raw string) *TargetingRule {
+	t.Helper()
+	var rule TargetingRule
+	if err := json.Unmarshal([]byte(raw), &rule); err != nil {
+		t.Fatal(err)
+	}
+	return &rule
+}
+
+// A regra proposta (sem hash_version) é simulada exatamente como ficaria
+// depois de salva no targeting-service
+func TestSimulationMatchesSavedRule(t *testing.T) {
+	tests := []struct {
+		name     string
+		current  string // regra atual da flag ("" = sem regra)
+		proposed string // corpo enviado ao /admin/simulate e ao targeting-service
+		saved    string // o que o targeting-service grava
+	}{
+		{
+			name:     "regra nova",
+			proposed: `{"rules": {"type": "PERCENTAGE", "value": 20}}`,
+			saved:    `{"is_enabled": true, "rules": {"type": "PERCENTAGE", "value": 20, "hash_version": 2}}`,
+		},
+		{
+			name:     "edição de regra v1",
+			current:  `{"is_enabled": true, "rules": {"type": "PERCENTAGE", "value": 10}}`,
+			proposed: `{"rules": {"type": "PERCENTAGE", "value": 20}}`,
+			saved:    `{"is_enabled": true, "rules": {"type": "PERCENTAGE", "value": 20, "hash_version": 1}}`,
+		},
+		{
+			name:     "edição de regra v2",
+			current:  `{"is_enabled": true, "rules": {"type": "PERCENTAGE", "value": 10, "hash_version": 2}}`,
+			proposed: `{"rules": {"rules": [{"condition": {"type": "PERCENTAGE", "value": 33.3}, "outcome": {"enabled": true}}]}}`,
+			saved:    `{"is_enabled": true, "rules": {"rules": [{"condition": {"type": "PERCENTAGE", "value": 33.3}, "outcome": {"enabled": true}}], "hash_version": 2}}`,
+		},
+	}
+
+	app := &App{}
+	flag := &Flag{Name: "enable-new-dashboard", IsEnabled: true}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var current *TargetingRule
+			if tt.current != "" {
+				current = decodeTargetingRule(t, tt.current)
+			}
+			proposed, err := decodeProposedRule(json.RawMessage(tt.proposed), current)
+			if err != nil {
+				t.Fatal(err)
+			}
+			simulated := &CombinedFlagInfo{Flag: flag, Rule: proposed}
+			saved := &CombinedFlagInfo{Flag: flag, Rule: decodeTargetingRule(t, tt.saved)}
+
+			for i := 0; i < 10000; i++ {
+				evalCtx := &EvaluationContext{Key: fmt.Sprintf("sim-user-%d", i)}
+				got := app.runEvaluationLogic(simulated, evalCtx)
+				want := app.runEvaluationLogic(saved, evalCtx)
+				if got.Result != want.Result {
+					t.Fatalf("%s: simulação %v, regra salva %v", evalCtx.Key, got.Result, want.Result)
+				}
+			}
+		})
+	}
+}
+
+// Uma hash_version explícita na proposta é mantida
+func TestSimulationKeepsExplicitHashVersion(t *testing.T) {
+	current := decodeTargetingRule(t, `{"is_enabled": true, "rules": {"type": "PERCENTAGE", "value": 10}}`)
+	proposed, err := decodeProposedRule(json.RawMessage(`{"rules": {"type": "PERCENTAGE", "value": 20, "hash_version": 2}}`), current)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if proposed.Rules.HashVersion != HashVersionHighRes {
+		t.Errorf("hash_version %d, esperado %d", proposed.Rules.HashVersion, HashVersionHighRes)
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"encoding/json"
+	"fmt"
 	"log"
 	"time"
 
@@ -11,28 +12,25 @@ import (
 
 // Evento que será enviado para a fila
 type EvaluationEvent struct {
-	UserID    string    `json:"user_id"`
-	FlagName  string    `json:"flag_name"`
-	Result    bool      `json:"result"`
-	Timestamp time.Time `json:"timestamp"`
+	UserID      string    `json:"user_id"`
+	FlagName    string    `json:"flag_name"`
+	Environment string    `json:"environment"`
+	Result      bool      `json:"result"`
+	Variation   string    `json:"variation,omitempty"`
+	Reason      Reason    `json:"reason"`
+	Holdout     bool      `json:"holdout"` // usuário no holdout global (para separar nas análises)
+	Timestamp   time.Time `json:"timestamp"`
 }
 
 // sendEvaluationEvent envia um evento para a fila SQS
-func (a *App) sendEvaluationEvent(userID, flagName string, result bool) {
+func (a *App) sendEvaluationEvent(environment, userID, flagName string, decision Decision) {
 	// Se a URL da fila não foi configurada, apenas loga localmente e sai.
 	if a.SqsSvc == nil || a.SqsQueueURL == "" {
-		log.Printf("[SQS_DISABLED] Evento: User '%s', Flag '%s', Result '%t'", userID, flagName, result)
+		log.Printf("[SQS_DISABLED] Evento: User '%s', Flag '%s' (%s), Result '%t', Variation '%s', Reason '%s'", userID, flagName, environment, decision.Result, decision.Variation, decision.Reason.Kind)
 		return
 	}
 
-	event := EvaluationEvent{
-		UserID:    userID,
-		FlagName:  flagName,
-		Result:    result,
-		Timestamp: time.Now().UTC(),
-	}
-
-	body, err := json.Marshal(event)
+	body, err := json.Marshal(a.newEvaluationEvent(environment, userID, flagName, decision))
 	if err != nil {
 		log.Printf("Erro ao serializar evento SQS: %v", err)
 		return
@@ -49,4 +47,63 @@ func (a *App) sendEvaluationEvent(userID, flagName string, result bool) {
 	} else {
 		log.Printf("Evento de avaliação enviado para SQS (Flag: %s)", flagName)
 	}
-}
\ No newline at end of file
+}
+
+// sendEvaluationEvents envia os eventos de uma avaliação em lote (/evaluate/all)
+// usando SendMessageBatch, em grupos de até 10 mensagens (limite do SQS)
+func (a *App) sendEvaluationEvents(environment, userID string, decisions map[string]Decision) {
+	if a.SqsSvc == nil || a.SqsQueueURL == "" {
+		log.Printf("[SQS_DISABLED] Lote de %d eventos para o User '%s'", len(decisions), userID)
+		return
+	}
+
+	var entries []*sqs.SendMessageBatchRequestEntry
+	flush := func() {
+		if len(entries) == 0 {
+			return
+		}
+		out, err := a.SqsSvc.SendMessageBatch(&sqs.SendMessageBatchInput{
+			Entries:  entries,
+			QueueUrl: aws.String(a.SqsQueueURL),
+		})
+		if err != nil {
+			log.Printf("Erro ao enviar lote para SQS: %v", err)
+		} else if len(out.Failed) > 0 {
+			log.Printf("Erro ao enviar %d de %d mensagens do lote para SQS", len(out.Failed), len(entries))
+		}
+		entries = nil
+	}
+
+	for flagName, decision := range decisions {
+		body, err := json.Marshal(a.newEvaluationEvent(environment, userID, flagName, decision))
+		if err != nil {
+			log.Printf("Erro ao serializar evento SQS: %v", err)
+			continue
+		}
+		entries = append(entries, &sqs.SendMessageBatchRequestEntry{
+			Id:          aws.String(fmt.Sprintf("%d", len(entries))),
+			MessageBody: aws.String(string(body)),
+		})
+		if len(entries) == 10 {
+			flush()
+		}
+	}
+	flush()
+
+	log.Printf("Lote de %d eventos de avaliação enviado para SQS (User: %s)", len(decisions), userID)
+}
+
+// newEvaluationEvent monta o evento de uma decisão. O marcador 'holdout'
+// vale para todas as flags (inclusive as isentas), já que descreve o usuário.
+func (a *App) newEvaluationEvent(environment, userID, flagName string, decision Decision) EvaluationEvent {
+	return EvaluationEvent{
+		UserID:      userID,
+		FlagName:    flagName,
+		Environment: environment,
+		Result:      decision.Result,
+		Variation:   decision.Variation,
+		Reason:      decision.Reason,
+		Holdout:     a.inHoldout(userID),
+		Timestamp:   time.Now().UTC(),
+	}
+}
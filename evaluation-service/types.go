@@ -1,41 +1,322 @@
 package main
 
-import "fmt"
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"time"
+)
 
 // --- Estruturas de Dados ---
 
 // Flag espelha a resposta do flag-service
 type Flag struct {
-	ID          int    `json:"id"`
-	Name        string `json:"name"`
-	Description string `json:"description"`
-	IsEnabled   bool   `json:"is_enabled"`
+	ID            int         `json:"id"`
+	Name          string      `json:"name"`
+	Description   string      `json:"description"`
+	IsEnabled     bool        `json:"is_enabled"`
+	Variations    []Variation `json:"variations,omitempty"`     // vazio = flag booleana
+	HoldoutExempt bool        `json:"holdout_exempt"`           // vale também para o holdout global
+	OffValue      interface{} `json:"off_value,omitempty"`      // valor quando a flag está desligada para o usuário
+	FallbackValue interface{} `json:"fallback_value,omitempty"` // valor quando a avaliação falha (ver defaults.go)
+}
+
+// Variation é uma variação nomeada de uma flag multivariada (teste A/B/n,
+// configuração remota). O 'value' pode ser string, número ou JSON.
+// ex: {"key": "blue", "value": "#0000FF", "weight": 50}
+type Variation struct {
+	Key    string      `json:"key"`
+	Value  interface{} `json:"value"`
+	Weight float64     `json:"weight"` // peso relativo na divisão (ex: 50 = 50%)
 }
 
 // TargetingRule espelha a resposta do targeting-service
 type TargetingRule struct {
-	ID         int    `json:"id"`
-	FlagName   string `json:"flag_name"`
-	IsEnabled  bool   `json:"is_enabled"`
-	Rules      Rule   `json:"rules"` // O objeto JSONB
+	ID        int     `json:"id"`
+	FlagName  string  `json:"flag_name"`
+	IsEnabled bool    `json:"is_enabled"`
+	Rules     RuleSet `json:"rules"` // O objeto JSONB
+}
+
+// RuleSet é a lista ordenada de regras de uma flag. A primeira regra
+// atendida define o resultado; se nenhuma for, vale o 'fallthrough'. ex:
+// {"rules": [{"id": "staff", "condition": {...}, "outcome": {...}}], "fallthrough": {"enabled": false}}
+type RuleSet struct {
+	Rules         []FlagRule     `json:"rules"`
+	Fallthrough   Outcome        `json:"fallthrough"`
+	HashVersion   int            `json:"hash_version,omitempty"`  // versão do bucketing (ausente = 1)
+	Prerequisites []Prerequisite `json:"prerequisites,omitempty"` // flags que precisam estar ligadas antes
+	Layer         *Layer         `json:"layer,omitempty"`         // camada de experimentos (exclusão mútua)
+}
+
+// Layer é a fatia [start, end) (em %) de uma camada de experimentos ocupada
+// pela flag. Flags da mesma camada dividem o mesmo espaço de buckets, então
+// cada usuário cai em no máximo uma delas.
+// ex: {"name": "pricing", "start": 0, "end": 50}
+type Layer struct {
+	Name  string  `json:"name"`
+	Start float64 `json:"start"`
+	End   float64 `json:"end"`
+}
+
+// Prerequisite é uma flag da qual esta depende, com o resultado exigido.
+// ex: {"flag": "enable-new-checkout"} ou {"flag": "checkout-layout", "variation": "v2"}
+type Prerequisite struct {
+	Flag      string `json:"flag"`
+	Result    *bool  `json:"result,omitempty"`    // resultado exigido (padrão: true)
+	Variation string `json:"variation,omitempty"` // variação exigida (opcional)
+}
+
+// satisfiedBy verifica se a decisão do pré-requisito atende ao exigido
+func (p Prerequisite) satisfiedBy(d Decision) bool {
+	expected := true
+	if p.Result != nil {
+		expected = *p.Result
+	}
+	if d.Result != expected {
+		return false
+	}
+	return p.Variation == "" || d.Variation == p.Variation
 }
 
-// Rule é o objeto JSONB aninhado
+// FlagRule é uma regra da lista: uma condição (árvore de Rule) e o seu resultado
+type FlagRule struct {
+	ID        string  `json:"id"`
+	Condition Rule    `json:"condition"`
+	Outcome   Outcome `json:"outcome"`
+}
+
+// Outcome é o resultado de uma regra (ou do fallthrough)
+type Outcome struct {
+	Enabled   bool               `json:"enabled"`
+	Variation string             `json:"variation,omitempty"` // variação fixa
+	Rollout   map[string]float64 `json:"rollout,omitempty"`   // pesos próprios por variação
+
+	// Chave/salt do sorteio da variação
+	Bucketing
+}
+
+// Bucketing define como o bucket determinístico é calculado.
+// Por padrão o hash é de 'key + flag_name'; 'bucket_by' troca a chave por um
+// atributo do contexto (ex: "org_id", "device_id") e 'salt' entra no hash
+// para reembaralhar a população sem renomear a flag.
+type Bucketing struct {
+	BucketBy string `json:"bucket_by,omitempty"`
+	Salt     string `json:"salt,omitempty"`
+}
+
+// UnmarshalJSON aceita tanto a lista ordenada quanto o formato antigo,
+// com uma única regra (ex: {"type": "PERCENTAGE", "value": 50}), que vira
+// uma lista de uma regra com fallthrough desligado.
+func (rs *RuleSet) UnmarshalJSON(data []byte) error {
+	var probe struct {
+		Type          *string        `json:"type"`
+		HashVersion   int            `json:"hash_version"`
+		Prerequisites []Prerequisite `json:"prerequisites"`
+		Layer         *Layer         `json:"layer"`
+	}
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return err
+	}
+
+	if probe.Type != nil {
+		var rule Rule
+		if err := json.Unmarshal(data, &rule); err != nil {
+			return err
+		}
+		*rs = RuleSet{
+			Rules:         []FlagRule{{ID: "default", Condition: rule, Outcome: Outcome{Enabled: true}}},
+			HashVersion:   probe.HashVersion,
+			Prerequisites: probe.Prerequisites,
+			Layer:         probe.Layer,
+		}
+		return nil
+	}
+
+	type ruleSetAlias RuleSet // evita recursão infinita no UnmarshalJSON
+	var alias ruleSetAlias
+	if err := json.Unmarshal(data, &alias); err != nil {
+		return err
+	}
+	*rs = RuleSet(alias)
+
+	// Regras sem 'id' recebem um id pela posição
+	for i := range rs.Rules {
+		if rs.Rules[i].ID == "" {
+			rs.Rules[i].ID = fmt.Sprintf("rule-%d", i+1)
+		}
+	}
+	return nil
+}
+
+// Rule é a condição de uma regra. Pode ser uma folha (PERCENTAGE, USER_LIST,
+// ATTRIBUTE, TIME_WINDOW, RAMP, SEGMENT, CEL) ou um nó lógico (AND, OR, NOT) com os filhos em 'rules',
+// formando uma árvore. ex:
+// {"type": "AND", "rules": [{"type": "ATTRIBUTE", ...}, {"type": "PERCENTAGE", "value": 20}]}
 type Rule struct {
-	Type  string      `json:"type"`  // ex: "PERCENTAGE"
-	Value interface{} `json:"value"` // ex: 50
+	Type    string      `json:"type"`              // ex: "PERCENTAGE", "USER_LIST", "ATTRIBUTE", "AND"
+	Value   interface{} `json:"value,omitempty"`   // ex: 50
+	Values  []string    `json:"values,omitempty"`  // ex: ["u1", "u2"] (USER_LIST), nomes de segmentos (SEGMENT)
+	Clauses []Clause    `json:"clauses,omitempty"` // condições sobre atributos (ATTRIBUTE)
+	Rules   []Rule      `json:"rules,omitempty"`   // filhos dos nós AND, OR e NOT
+	Exclude []string    `json:"exclude,omitempty"` // ex: ["u3"] (nunca recebem a flag)
+
+	// Agendamento (TIME_WINDOW e RAMP)
+	Start    string  `json:"start,omitempty"`    // ex: "2026-11-03T09:00" ou RFC 3339
+	End      string  `json:"end,omitempty"`      // ex: "2026-11-10T09:00" ou RFC 3339
+	Timezone string  `json:"timezone,omitempty"` // ex: "America/Sao_Paulo" (padrão UTC)
+	From     float64 `json:"from,omitempty"`     // RAMP: porcentagem no início
+	To       float64 `json:"to,omitempty"`       // RAMP: porcentagem no fim
+	Mode     string  `json:"mode,omitempty"`     // RAMP: "linear" (padrão) ou "step"
+	Steps    int     `json:"steps,omitempty"`    // RAMP "step": número de degraus
+
+	// Chave/salt do bucket (PERCENTAGE e RAMP)
+	Bucketing
+
+	compiled *compiledRule // forma tipada, montada no cache em memória (ver compile.go)
+}
+
+// Clause é uma condição sobre um atributo do contexto de avaliação
+// ex: {"attribute": "country", "operator": "in", "values": ["BR", "PT"]}
+type Clause struct {
+	Attribute string        `json:"attribute"`
+	Operator  string        `json:"operator"` // ex: "equals", "in", "contains", "startsWith", "greaterThan", "regex", "after"
+	Values    []interface{} `json:"values"`
+	Negate    bool          `json:"negate,omitempty"` // inverte o resultado da cláusula
+
+	regexps []*regexp.Regexp // regex já compiladas, uma por valor (ver compile.go)
+}
+
+// EvaluationContext é "quem" está sendo avaliado: a chave do usuário
+// e atributos livres (país, plano, versão do app...)
+type EvaluationContext struct {
+	Key        string                 `json:"key"`
+	Attributes map[string]interface{} `json:"attributes"`
+	IP         string                 `json:"-"` // IP do cliente, obtido da requisição (ver ip.go)
+	// Ambiente das flags avaliadas (ver environment.go). Não é um atributo:
+	// vem da chave de SDK ou do header, nunca do corpo da requisição.
+	Environment string `json:"-"`
+}
+
+// attribute busca um atributo do contexto. "key" e "user_id" apontam para a
+// chave e "ip" para o IP do cliente (que não pode ser enviado nos atributos).
+func (c *EvaluationContext) attribute(name string) (interface{}, bool) {
+	if name == "key" || name == "user_id" {
+		return c.Key, true
+	}
+	if name == "ip" {
+		return c.IP, c.IP != ""
+	}
+	value, ok := c.Attributes[name]
+	if !ok || value == nil {
+		return nil, false
+	}
+	return value, true
+}
+
+// Decision é o resultado de uma avaliação.
+// 'Result' continua sendo o booleano de sempre; 'Variation' e 'Value'
+// só são preenchidos para flags multivariadas que foram liberadas.
+type Decision struct {
+	Result    bool
+	Variation string
+	Value     interface{}
+	Reason    Reason
+}
+
+// Tipos de motivo (Reason.Kind) de uma decisão
+const (
+	ReasonFlagDisabled = "FLAG_DISABLED"  // kill switch desligado
+	ReasonNoRule       = "NO_RULE"        // flag ligada e sem regra (ou regra desativada)
+	ReasonRuleMatch    = "RULE_MATCH"     // uma regra da lista foi atendida
+	ReasonFallthrough  = "FALLTHROUGH"    // nenhuma regra atendida
+	ReasonFlagNotFound = "FLAG_NOT_FOUND" // flag não existe no flag-service
+	ReasonError        = "ERROR"          // erro ao avaliar (ver Reason.ErrorKind)
+
+	ReasonPrerequisiteFailed = "PREREQUISITE_FAILED" // um pré-requisito não foi atendido
+	ReasonOverride           = "OVERRIDE"            // resultado forçado para o usuário (ex: QA), não é rollout
+	ReasonLayerExcluded      = "LAYER_EXCLUDED"      // usuário caiu na fatia de outra flag da camada
+	ReasonHoldout            = "HOLDOUT"             // usuário no holdout global (não vê nenhuma novidade)
+)
+
+// Tipos de erro (Reason.ErrorKind)
+const (
+	ErrorUnknownRuleType    = "UNKNOWN_RULE_TYPE"   // tipo de regra não suportado
+	ErrorMalformedRule      = "MALFORMED_RULE"      // regra com valores inválidos
+	ErrorServiceUnavailable = "SERVICE_UNAVAILABLE" // flag/targeting-service fora do ar
+	ErrorPrerequisiteCycle  = "PREREQUISITE_CYCLE"  // pré-requisitos em ciclo (A -> B -> A)
+	ErrorSegmentNotFound    = "SEGMENT_NOT_FOUND"   // regra referencia um segmento inexistente
+)
+
+// Reason explica por que uma avaliação chegou ao resultado
+type Reason struct {
+	Kind         string `json:"kind"`
+	RuleID       string `json:"rule_id,omitempty"`      // só em RULE_MATCH
+	ErrorKind    string `json:"error_kind,omitempty"`   // só em ERROR
+	Prerequisite string `json:"prerequisite,omitempty"` // só em PREREQUISITE_FAILED
+	Layer        string `json:"layer,omitempty"`        // só em LAYER_EXCLUDED
+}
+
+// Segment espelha um segmento reutilizável do targeting-service
+// (ex: "funcionarios", "beta-testers"), referenciado pelas regras SEGMENT
+type Segment struct {
+	ID          int      `json:"id"`
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Included    []string `json:"included"` // sempre dentro
+	Excluded    []string `json:"excluded"` // sempre fora (vence o resto)
+	Rules       []Rule   `json:"rules"`    // dentro se atender QUALQUER uma
+}
+
+// Override espelha um override por usuário do targeting-service:
+// força o resultado (e a variação) de uma flag para uma chave de contexto
+type Override struct {
+	FlagName  string     `json:"flag_name"`
+	UserKey   string     `json:"user_key"`
+	Enabled   bool       `json:"enabled"`
+	Variation string     `json:"variation,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"` // nil = não expira
 }
 
 // CombinedFlagInfo é a estrutura que salvamos no cache
 type CombinedFlagInfo struct {
-	Flag *Flag
-	Rule *TargetingRule
+	Flag      *Flag
+	Rule      *TargetingRule
+	Overrides []Override
+}
+
+// override retorna o override ainda válido da chave, se houver. A expiração é
+// verificada a cada avaliação, então um override expira na hora mesmo em cache.
+func (info *CombinedFlagInfo) override(key string, now time.Time) *Override {
+	for i := range info.Overrides {
+		o := &info.Overrides[i]
+		if o.UserKey == key && (o.ExpiresAt == nil || now.Before(*o.ExpiresAt)) {
+			return o
+		}
+	}
+	return nil
 }
 
 // NotFoundError é um erro customizado
 type NotFoundError struct {
 	FlagName string
 }
+
 func (e *NotFoundError) Error() string {
 	return fmt.Sprintf("flag ou regra '%s' não encontrada", e.FlagName)
-}
\ No newline at end of file
+}
+
+// RuleError é um erro na avaliação de uma regra, classificado por tipo
+type RuleError struct {
+	Kind string // ErrorUnknownRuleType, ErrorMalformedRule...
+	Msg  string
+}
+
+func (e *RuleError) Error() string {
+	return e.Msg
+}
+
+// newRuleError cria um RuleError do tipo ErrorMalformedRule
+func newRuleError(format string, args ...interface{}) *RuleError {
+	return &RuleError{Kind: ErrorMalformedRule, Msg: fmt.Sprintf(format, args...)}
+}
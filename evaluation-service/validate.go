@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// ValidationError é um problema encontrado em uma das regras do RuleSet
+type ValidationError struct {
+	RuleID string `json:"rule_id"`
+	Error  string `json:"error"`
+}
+
+// validateRuleSet verifica o schema de todas as regras (cada tipo com o
+// Validate do seu registro, ver registry.go), para que o erro apareça ao
+// salvar a regra e não como ERROR em cada avaliação
+func validateRuleSet(rs RuleSet) []ValidationError {
+	errs := []ValidationError{}
+	for _, flagRule := range rs.Rules {
+		if err := validateRule(flagRule.Condition); err != nil {
+			errs = append(errs, ValidationError{RuleID: flagRule.ID, Error: err.Error()})
+		}
+	}
+	return errs
+}
+
+// validateRule valida um nó da árvore de regras. Os nós lógicos (AND, OR,
+// NOT) validam os filhos. Um tipo desconhecido é sempre rejeitado aqui,
+// independente da UNKNOWN_RULE_TYPE_POLICY.
+func validateRule(rule Rule) error {
+	ruleType, ok := lookupRuleType(rule.Type)
+	if !ok {
+		return &RuleError{Kind: ErrorUnknownRuleType, Msg: fmt.Sprintf("tipo de regra desconhecido '%s'", rule.Type)}
+	}
+	if ruleType.Validate == nil {
+		return nil
+	}
+	return ruleType.Validate(rule)
+}
+
+// validateRulesHandler valida um RuleSet (o mesmo JSON do campo 'rules' do
+// targeting-service) sem salvá-lo. Responde 200 se for válido, ou 422 com a
+// lista de erros.
+func (a *App) validateRulesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodPost {
+		http.Error(w, `{"error": "Método não permitido"}`, http.StatusMethodNotAllowed)
+		return
+	}
+
+	var rs RuleSet
+	var errs []ValidationError
+	if err := json.NewDecoder(r.Body).Decode(&rs); err != nil {
+		// Um campo com o tipo errado (ex: números em 'values' de um USER_LIST)
+		// é um erro da regra, e não do corpo da requisição
+		var typeErr *json.UnmarshalTypeError
+		if !errors.As(err, &typeErr) {
+			http.Error(w, `{"error": "Corpo JSON inválido"}`, http.StatusBadRequest)
+			return
+		}
+		errs = []ValidationError{{Error: fmt.Sprintf("campo '%s' não aceita %s", typeErr.Field, typeErr.Value)}}
+	} else {
+		errs = validateRuleSet(rs)
+	}
+
+	status := http.StatusOK
+	if len(errs) > 0 {
+		status = http.StatusUnprocessableEntity
+	}
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{"valid": len(errs) == 0, "errors": errs})
+}
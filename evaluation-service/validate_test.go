@@ -0,0 +1,71 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestValidateRule(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    Rule
+		wantErr bool
+	}{
+		{"USER_LIST válido", Rule{Type: "USER_LIST", Values: []string{"u1", "u2"}}, false},
+		{"USER_LIST sem usuários", Rule{Type: "USER_LIST"}, true},
+		{"USER_LIST com chave vazia", Rule{Type: "USER_LIST", Values: []string{"u1", " "}}, true},
+
+		{"regex com string", attributeRule("regex", "^[a-z]+@empresa\\.com$"), false},
+		{"regex com número", attributeRule("regex", 42.0), true},
+		{"contains com booleano", attributeRule("contains", true), true},
+		{"startsWith com string", attributeRule("startsWith", "beta-"), false},
+		{"endsWith com número", attributeRule("endsWith", 7.0), true},
+		{"greaterThan com número", attributeRule("greaterThan", 18.0), false},
+		{"greaterThan com string numérica", attributeRule("greaterThan", "18"), false},
+		{"lessThan com texto", attributeRule("lessThan", "dezoito"), true},
+		{"equals com número", attributeRule("equals", 42.0), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateRule(tt.rule)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("erro %v, esperado erro: %v", err, tt.wantErr)
+			}
+			if err != nil && errorKind(err) != ErrorMalformedRule {
+				t.Errorf("tipo de erro %s, esperado MALFORMED_RULE", errorKind(err))
+			}
+		})
+	}
+}
+
+func attributeRule(operator string, value interface{}) Rule {
+	return Rule{Type: "ATTRIBUTE", Clauses: []Clause{{Attribute: "email", Operator: operator, Values: []interface{}{value}}}}
+}
+
+// Um valor com o tipo errado no JSON é erro da regra (422), e não do corpo (400)
+func TestValidateRulesHandlerTypeErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+	}{
+		{"regra válida", `{"rules": [{"id": "r1", "condition": {"type": "USER_LIST", "values": ["u1"]}}]}`, http.StatusOK},
+		{"USER_LIST com números", `{"rules": [{"id": "r1", "condition": {"type": "USER_LIST", "values": [1, 2]}}]}`, http.StatusUnprocessableEntity},
+		{"JSON inválido", `{"rules": [`, http.StatusBadRequest},
+	}
+
+	app := &App{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/validate", strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+			app.validateRulesHandler(w, r)
+			if w.Code != tt.wantStatus {
+				t.Errorf("status %d, esperado %d (%s)", w.Code, tt.wantStatus, w.Body.String())
+			}
+		})
+	}
+}
@@ -2,7 +2,7 @@ import os
 import sys
 import psycopg2
 import requests
-from psycopg2.extras import RealDictCursor
+from psycopg2.extras import RealDictCursor, Json
 from psycopg2.pool import SimpleConnectionPool
 from flask import Flask, request, jsonify
 from dotenv import load_dotenv
@@ -26,6 +26,11 @@ if not DATABASE_URL or not AUTH_SERVICE_URL:
     log.critical("Erro: DATABASE_URL e AUTH_SERVICE_URL devem ser definidos.")
     sys.exit(1)
 
+# Ambientes aceitos (ex: "development,staging,production"). Requisições sem
+# ?environment= usam o padrão, que é o ambiente dos registros antigos.
+ENVIRONMENTS = [e.strip() for e in os.getenv("ENVIRONMENTS", "development,staging,production").split(",") if e.strip()]
+DEFAULT_ENVIRONMENT = "production"
+
 # --- Pool de Conexão com o Banco ---
 # Inicializa o pool de conexões (Mín: 1, Máx: 5 conexões)
 try:
@@ -64,6 +69,36 @@ def require_auth(f):
         return f(*args, **kwargs)
     return decorated
 
+# --- Ambiente ---
+def with_environment(f):
+    """ Lê o ambiente da requisição (?environment=) e o passa para a rota como 'environment' """
+    @wraps(f)
+    def decorated(*args, **kwargs):
+        environment = request.args.get('environment', DEFAULT_ENVIRONMENT)
+        if environment not in ENVIRONMENTS:
+            return jsonify({"error": f"Ambiente desconhecido: '{environment}'"}), 400
+        return f(*args, environment=environment, **kwargs)
+    return decorated
+
+# --- Validação ---
+def validate_variations(variations):
+    """ Valida a lista de variações de uma flag multivariada. Retorna a mensagem de erro ou None """
+    if variations is None:
+        return None
+    if not isinstance(variations, list):
+        return "'variations' deve ser uma lista"
+    keys = set()
+    for variation in variations:
+        if not isinstance(variation, dict) or not variation.get('key'):
+            return "Cada variação deve ser um objeto com 'key'"
+        if variation['key'] in keys:
+            return f"Variação duplicada: '{variation['key']}'"
+        keys.add(variation['key'])
+        weight = variation.get('weight', 0)
+        if isinstance(weight, bool) or not isinstance(weight, (int, float)) or weight < 0:
+            return f"'weight' da variação '{variation['key']}' deve ser um número >= 0"
+    return None
+
 # --- Endpoints da API ---
 
 @app.route('/health')
@@ -72,7 +107,8 @@ def health():
 
 @app.route('/flags', methods=['POST'])
 @require_auth
-def create_flag():
+@with_environment
+def create_flag(environment):
     """ Cria uma nova definição de feature flag """
     data = request.get_json()
     if not data or 'name' not in data:
@@ -81,6 +117,16 @@ def create_flag():
     name = data['name']
     description = data.get('description', '')
     is_enabled = data.get('is_enabled', False)
+    variations = data.get('variations')
+    holdout_exempt = data.get('holdout_exempt', False)
+    off_value = data.get('off_value')
+    fallback_value = data.get('fallback_value')
+    
+    error = validate_variations(variations)
+    if error:
+        return jsonify({"error": error}), 400
+    if not isinstance(holdout_exempt, bool):
+        return jsonify({"error": "'holdout_exempt' deve ser booleano"}), 400
     
     conn = None
     cur = None
@@ -88,18 +134,19 @@ def create_flag():
         conn = pool.getconn()
         cur = conn.cursor(cursor_factory=RealDictCursor)
         cur.execute(
-            "INSERT INTO flags (name, description, is_enabled, created_at, updated_at) "
-            "VALUES (%s, %s, %s, NOW(), NOW()) RETURNING *",
-            (name, description, is_enabled)
+            "INSERT INTO flags (name, environment, description, is_enabled, variations, holdout_exempt, off_value, fallback_value, created_at, updated_at) "
+            "VALUES (%s, %s, %s, %s, %s, %s, %s, %s, NOW(), NOW()) RETURNING *",
+            (name, environment, description, is_enabled, Json(variations) if variations is not None else None, holdout_exempt,
+             Json(off_value) if off_value is not None else None, Json(fallback_value) if fallback_value is not None else None)
         )
         new_flag = cur.fetchone()
         conn.commit()
-        log.info(f"Flag '{name}' criada com sucesso.")
+        log.info(f"Flag '{name}' criada com sucesso no ambiente '{environment}'.")
         return jsonify(new_flag), 201
     except psycopg2.IntegrityError:
         if conn: conn.rollback()
-        log.warning(f"Tentativa de criar flag duplicada: '{name}'")
-        return jsonify({"error": f"Flag '{name}' já existe"}), 409
+        log.warning(f"Tentativa de criar flag duplicada: '{name}' ({environment})")
+        return jsonify({"error": f"Flag '{name}' já existe no ambiente '{environment}'"}), 409
     except Exception as e:
         if conn: conn.rollback()
         log.error(f"Erro ao criar flag: {e}")
@@ -110,14 +157,15 @@ def create_flag():
 
 @app.route('/flags', methods=['GET'])
 @require_auth
-def get_flags():
-    """ Lista todas as feature flags """
+@with_environment
+def get_flags(environment):
+    """ Lista todas as feature flags do ambiente """
     conn = None
     cur = None
     try:
         conn = pool.getconn()
         cur = conn.cursor(cursor_factory=RealDictCursor)
-        cur.execute("SELECT * FROM flags ORDER BY name")
+        cur.execute("SELECT * FROM flags WHERE environment = %s ORDER BY name", (environment,))
         flags = cur.fetchall()
         return jsonify(flags)
     except Exception as e:
@@ -129,14 +177,15 @@ def get_flags():
 
 @app.route('/flags/<string:name>', methods=['GET'])
 @require_auth
-def get_flag(name):
+@with_environment
+def get_flag(name, environment):
     """ Busca uma feature flag específica pelo nome """
     conn = None
     cur = None
     try:
         conn = pool.getconn()
         cur = conn.cursor(cursor_factory=RealDictCursor)
-        cur.execute("SELECT * FROM flags WHERE name = %s", (name,))
+        cur.execute("SELECT * FROM flags WHERE name = %s AND environment = %s", (name, environment))
         flag = cur.fetchone()
         if not flag:
             return jsonify({"error": "Flag não encontrada"}), 404
@@ -150,8 +199,9 @@ def get_flag(name):
 
 @app.route('/flags/<string:name>', methods=['PUT'])
 @require_auth
-def update_flag(name):
-    """ Atualiza uma feature flag (descrição ou status 'is_enabled') """
+@with_environment
+def update_flag(name, environment):
+    """ Atualiza uma feature flag (descrição, status 'is_enabled', variações, 'holdout_exempt', 'off_value' ou 'fallback_value') """
     data = request.get_json()
     if not data:
         return jsonify({"error": "Corpo da requisição obrigatório"}), 400
@@ -166,13 +216,29 @@ def update_flag(name):
     if 'is_enabled' in data:
         fields.append("is_enabled = %s")
         values.append(data['is_enabled'])
+    if 'variations' in data:
+        error = validate_variations(data['variations'])
+        if error:
+            return jsonify({"error": error}), 400
+        fields.append("variations = %s")
+        values.append(Json(data['variations']) if data['variations'] is not None else None)
+    if 'holdout_exempt' in data:
+        if not isinstance(data['holdout_exempt'], bool):
+            return jsonify({"error": "'holdout_exempt' deve ser booleano"}), 400
+        fields.append("holdout_exempt = %s")
+        values.append(data['holdout_exempt'])
+    for column in ('off_value', 'fallback_value'):
+        # Qualquer JSON; null remove o valor
+        if column in data:
+            fields.append(f"{column} = %s")
+            values.append(Json(data[column]) if data[column] is not None else None)
     
     if not fields:
-        return jsonify({"error": "Pelo menos um campo ('description', 'is_enabled') é obrigatório"}), 400
+        return jsonify({"error": "Pelo menos um campo ('description', 'is_enabled', 'variations', 'holdout_exempt', 'off_value', 'fallback_value') é obrigatório"}), 400
     
-    values.append(name) # Adiciona o 'name' para a cláusula WHERE
+    values.extend([name, environment]) # Adiciona o 'name' e o ambiente para a cláusula WHERE
     
-    query = f"UPDATE flags SET {', '.join(fields)} WHERE name = %s RETURNING *"
+    query = f"UPDATE flags SET {', '.join(fields)} WHERE name = %s AND environment = %s RETURNING *"
     
     conn = None
     cur = None
@@ -198,14 +264,15 @@ def update_flag(name):
 
 @app.route('/flags/<string:name>', methods=['DELETE'])
 @require_auth
-def delete_flag(name):
+@with_environment
+def delete_flag(name, environment):
     """ Deleta uma feature flag """
     conn = None
     cur = None
     try:
         conn = pool.getconn()
         cur = conn.cursor()
-        cur.execute("DELETE FROM flags WHERE name = %s", (name,))
+        cur.execute("DELETE FROM flags WHERE name = %s AND environment = %s", (name, environment))
         
         if cur.rowcount == 0:
             return jsonify({"error": "Flag não encontrada"}), 404
@@ -1,18 +1,46 @@
 CREATE TABLE IF NOT EXISTS flags (
     id SERIAL PRIMARY KEY,
 
-    -- 'name' é a chave de negócio única (ex: 'enable-new-checkout')
-    name VARCHAR(100) UNIQUE NOT NULL, 
+    -- 'name' é a chave de negócio (ex: 'enable-new-checkout'), única por ambiente
+    name VARCHAR(100) NOT NULL, 
+    
+    -- Ambiente da flag (ex: 'development', 'staging', 'production').
+    -- Cada ambiente tem o seu próprio registro, então ligar em staging não afeta prod.
+    environment VARCHAR(50) NOT NULL DEFAULT 'production',
     
     description TEXT,
     
     -- Este é o 'kill switch' global. Se for false, a flag está desativada para todos.
     is_enabled BOOLEAN NOT NULL DEFAULT false,
     
+    -- Variações nomeadas (flags multivariadas). NULL = flag booleana.
+    -- Ex: [{"key": "blue", "value": "#0000FF", "weight": 50}, {"key": "red", "value": "#FF0000", "weight": 50}]
+    variations JSONB,
+    
+    -- Flags fora do holdout global (ex: correções de segurança), que valem para todos
+    holdout_exempt BOOLEAN NOT NULL DEFAULT false,
+    
+    -- Valores servidos pelo evaluation-service (qualquer JSON, NULL = nenhum):
+    -- 'off_value' quando a flag está desligada para o usuário e
+    -- 'fallback_value' quando a avaliação falha (ex: serviços fora do ar)
+    off_value JSONB,
+    fallback_value JSONB,
+    
     created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
 );
 
+-- Para bancos criados antes das colunas novas
+ALTER TABLE flags ADD COLUMN IF NOT EXISTS variations JSONB;
+ALTER TABLE flags ADD COLUMN IF NOT EXISTS holdout_exempt BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE flags ADD COLUMN IF NOT EXISTS environment VARCHAR(50) NOT NULL DEFAULT 'production';
+ALTER TABLE flags ADD COLUMN IF NOT EXISTS off_value JSONB;
+ALTER TABLE flags ADD COLUMN IF NOT EXISTS fallback_value JSONB;
+
+-- O nome é único POR AMBIENTE (antes era único globalmente)
+ALTER TABLE flags DROP CONSTRAINT IF EXISTS flags_name_key;
+CREATE UNIQUE INDEX IF NOT EXISTS flags_name_environment_key ON flags (name, environment);
+
 -- Opcional, mas boa prática: Trigger para atualizar 'updated_at' automaticamente
 CREATE OR REPLACE FUNCTION trigger_set_timestamp()
 RETURNS TRIGGER AS $$
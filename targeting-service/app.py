@@ -8,6 +8,7 @@ from psycopg2.pool import SimpleConnectionPool
 from flask import Flask, request, jsonify
 from dotenv import load_dotenv
 from functools import wraps
+from datetime import datetime, timezone
 import logging
 
 # Configura o logging
@@ -22,11 +23,22 @@ app = Flask(__name__)
 # --- Configuração ---
 DATABASE_URL = os.getenv("DATABASE_URL")
 AUTH_SERVICE_URL = os.getenv("AUTH_SERVICE_URL")
+# Valida o schema das regras no evaluation-service (obrigatório para regras CEL)
+EVALUATION_SERVICE_URL = os.getenv("EVALUATION_SERVICE_URL")
 
 if not DATABASE_URL or not AUTH_SERVICE_URL:
     log.critical("Erro: DATABASE_URL e AUTH_SERVICE_URL devem ser definidos.")
     sys.exit(1)
 
+# Ambientes aceitos (os mesmos do flag-service). Requisições sem
+# ?environment= usam o padrão, que é o ambiente dos registros antigos.
+ENVIRONMENTS = [e.strip() for e in os.getenv("ENVIRONMENTS", "development,staging,production").split(",") if e.strip()]
+DEFAULT_ENVIRONMENT = "production"
+
+# Versão do hash de bucketing gravada nas regras novas (ver evaluation-service).
+# Regras antigas (sem 'hash_version') continuam na versão 1 (100 buckets).
+CURRENT_HASH_VERSION = 2
+
 # --- Pool de Conexão com o Banco ---
 try:
     pool = SimpleConnectionPool(1, 5, dsn=DATABASE_URL)
@@ -62,6 +74,80 @@ def require_auth(f):
         return f(*args, **kwargs)
     return decorated
 
+# --- Ambiente (Idêntico ao flag-service) ---
+def with_environment(f):
+    """ Lê o ambiente da requisição (?environment=) e o passa para a rota como 'environment' """
+    @wraps(f)
+    def decorated(*args, **kwargs):
+        environment = request.args.get('environment', DEFAULT_ENVIRONMENT)
+        if environment not in ENVIRONMENTS:
+            return jsonify({"error": f"Ambiente desconhecido: '{environment}'"}), 400
+        return f(*args, environment=environment, **kwargs)
+    return decorated
+
+# --- Camadas de experimentos ---
+def validate_layer(rules_obj):
+    """ Valida a camada de experimentos ('layer') das regras. Retorna a mensagem de erro ou None """
+    layer = rules_obj.get('layer') if isinstance(rules_obj, dict) else None
+    if layer is None:
+        return None
+    if not isinstance(layer, dict) or not isinstance(layer.get('name'), str) or not layer['name']:
+        return "'layer' deve ser um objeto com 'name'"
+    start, end = layer.get('start', 0), layer.get('end')
+    for value in (start, end):
+        if isinstance(value, bool) or not isinstance(value, (int, float)):
+            return "'start' e 'end' da camada devem ser números (porcentagens)"
+    if not 0 <= start < end <= 100:
+        return "A fatia da camada deve respeitar 0 <= start < end <= 100"
+    return None
+
+def find_layer_conflict(cur, environment, flag_name, layer):
+    """ Retorna outra flag do ambiente cuja fatia na mesma camada se sobrepõe a esta, ou None """
+    cur.execute(
+        "SELECT flag_name FROM targeting_rules "
+        "WHERE environment = %s AND flag_name <> %s AND rules->'layer'->>'name' = %s "
+        "AND COALESCE((rules->'layer'->>'start')::numeric, 0) < %s "
+        "AND (rules->'layer'->>'end')::numeric > %s LIMIT 1",
+        (environment, flag_name, layer['name'], layer['end'], layer.get('start', 0))
+    )
+    row = cur.fetchone()
+    return row['flag_name'] if row else None
+
+# --- Validação no evaluation-service ---
+def contains_rule_type(node, rule_type):
+    """ Verifica se algum nó da árvore de regras é do tipo informado """
+    if isinstance(node, dict):
+        if node.get('type') == rule_type:
+            return True
+        return any(contains_rule_type(value, rule_type) for value in node.values())
+    if isinstance(node, list):
+        return any(contains_rule_type(item, rule_type) for item in node)
+    return False
+
+def validate_rules(rules_obj):
+    """ Valida as regras (tipos, campos, expressões CEL) no evaluation-service. Retorna (resposta de erro, status) ou None """
+    if not EVALUATION_SERVICE_URL:
+        if contains_rule_type(rules_obj, 'CEL'):
+            return jsonify({"error": "Regras CEL exigem EVALUATION_SERVICE_URL para validação"}), 503
+        return None
+    try:
+        response = requests.post(
+            f"{EVALUATION_SERVICE_URL}/admin/rules/validate",
+            json=rules_obj,
+            headers={"Authorization": request.headers.get("Authorization")},
+            timeout=3
+        )
+    except requests.exceptions.RequestException as e:
+        log.error(f"Erro ao conectar com o evaluation-service: {e}")
+        return jsonify({"error": "Serviço de validação de regras indisponível"}), 503
+
+    if response.status_code == 422:
+        return jsonify({"error": "Regras inválidas", "details": response.json().get('errors', [])}), 400
+    if response.status_code != 200:
+        log.error(f"Falha na validação das regras (status: {response.status_code})")
+        return jsonify({"error": "Serviço de validação de regras indisponível"}), 503
+    return None
+
 # --- Endpoints da API ---
 
 @app.route('/health')
@@ -70,7 +156,8 @@ def health():
 
 @app.route('/rules', methods=['POST'])
 @require_auth
-def create_rule():
+@with_environment
+def create_rule(environment):
     """ Cria uma nova regra de segmentação para uma flag """
     data = request.get_json()
     if not data or 'flag_name' not in data or 'rules' not in data:
@@ -80,24 +167,42 @@ def create_rule():
     rules_obj = data['rules'] # O objeto JSON
     is_enabled = data.get('is_enabled', True)
     
+    error = validate_layer(rules_obj)
+    if error:
+        return jsonify({"error": error}), 400
+    invalid = validate_rules(rules_obj)
+    if invalid:
+        return invalid
+    
+    # Regras novas usam o bucketing de alta resolução (0-99999)
+    if isinstance(rules_obj, dict):
+        rules_obj.setdefault('hash_version', CURRENT_HASH_VERSION)
+    
     conn = None
     cur = None
     try:
         conn = pool.getconn()
         cur = conn.cursor(cursor_factory=RealDictCursor)
+        
+        # Flags da mesma camada não podem dividir usuários
+        if isinstance(rules_obj, dict) and rules_obj.get('layer'):
+            conflict = find_layer_conflict(cur, environment, flag_name, rules_obj['layer'])
+            if conflict:
+                return jsonify({"error": f"A fatia da camada '{rules_obj['layer']['name']}' se sobrepõe à da flag '{conflict}'"}), 409
+        
         cur.execute(
-            "INSERT INTO targeting_rules (flag_name, is_enabled, rules, created_at, updated_at) "
-            "VALUES (%s, %s, %s, NOW(), NOW()) RETURNING *",
-            (flag_name, is_enabled, Json(rules_obj)) # Usa Json() para serializar
+            "INSERT INTO targeting_rules (flag_name, environment, is_enabled, rules, created_at, updated_at) "
+            "VALUES (%s, %s, %s, %s, NOW(), NOW()) RETURNING *",
+            (flag_name, environment, is_enabled, Json(rules_obj)) # Usa Json() para serializar
         )
         new_rule = cur.fetchone()
         conn.commit()
-        log.info(f"Regra para '{flag_name}' criada com sucesso.")
+        log.info(f"Regra para '{flag_name}' criada com sucesso no ambiente '{environment}'.")
         return jsonify(new_rule), 201
     except psycopg2.IntegrityError:
         if conn: conn.rollback()
-        log.warning(f"Tentativa de criar regra duplicada: '{flag_name}'")
-        return jsonify({"error": f"Regra para a flag '{flag_name}' já existe"}), 409
+        log.warning(f"Tentativa de criar regra duplicada: '{flag_name}' ({environment})")
+        return jsonify({"error": f"Regra para a flag '{flag_name}' já existe no ambiente '{environment}'"}), 409
     except Exception as e:
         if conn: conn.rollback()
         log.error(f"Erro ao criar regra: {e}")
@@ -106,16 +211,37 @@ def create_rule():
         if cur: cur.close()
         if conn: pool.putconn(conn)
 
+@app.route('/rules', methods=['GET'])
+@require_auth
+@with_environment
+def get_rules(environment):
+    """ Lista todas as regras de segmentação do ambiente (usado na avaliação em lote) """
+    conn = None
+    cur = None
+    try:
+        conn = pool.getconn()
+        cur = conn.cursor(cursor_factory=RealDictCursor)
+        cur.execute("SELECT * FROM targeting_rules WHERE environment = %s ORDER BY flag_name", (environment,))
+        rules = cur.fetchall()
+        return jsonify(rules)
+    except Exception as e:
+        log.error(f"Erro ao buscar regras: {e}")
+        return jsonify({"error": "Erro interno do servidor", "details": str(e)}), 500
+    finally:
+        if cur: cur.close()
+        if conn: pool.putconn(conn)
+
 @app.route('/rules/<string:flag_name>', methods=['GET'])
 @require_auth
-def get_rule(flag_name):
+@with_environment
+def get_rule(flag_name, environment):
     """ Busca uma regra de segmentação pelo nome da flag """
     conn = None
     cur = None
     try:
         conn = pool.getconn()
         cur = conn.cursor(cursor_factory=RealDictCursor)
-        cur.execute("SELECT * FROM targeting_rules WHERE flag_name = %s", (flag_name,))
+        cur.execute("SELECT * FROM targeting_rules WHERE flag_name = %s AND environment = %s", (flag_name, environment))
         rule = cur.fetchone()
         if not rule:
             return jsonify({"error": "Regra não encontrada"}), 404
@@ -129,7 +255,8 @@ def get_rule(flag_name):
 
 @app.route('/rules/<string:flag_name>', methods=['PUT'])
 @require_auth
-def update_rule(flag_name):
+@with_environment
+def update_rule(flag_name, environment):
     """ Atualiza a regra de segmentação de uma flag """
     data = request.get_json()
     if not data:
@@ -138,9 +265,22 @@ def update_rule(flag_name):
     fields = []
     values = []
     
+    rules_obj = None
     if 'rules' in data:
-        fields.append("rules = %s")
-        values.append(Json(data['rules'])) # Serializa o JSON
+        rules_obj = data['rules']
+        error = validate_layer(rules_obj)
+        if error:
+            return jsonify({"error": error}), 400
+        invalid = validate_rules(rules_obj)
+        if invalid:
+            return invalid
+        if isinstance(rules_obj, dict) and 'hash_version' not in rules_obj:
+            # Mantém a versão do hash da regra existente (ou 1, se ela não tinha),
+            # para que uma edição não redistribua os usuários da flag
+            fields.append("rules = %s::jsonb || jsonb_build_object('hash_version', COALESCE(rules->'hash_version', '1'::jsonb))")
+        else:
+            fields.append("rules = %s")
+        values.append(Json(rules_obj)) # Serializa o JSON
     if 'is_enabled' in data:
         fields.append("is_enabled = %s")
         values.append(data['is_enabled'])
@@ -148,15 +288,22 @@ def update_rule(flag_name):
     if not fields:
         return jsonify({"error": "Pelo menos um campo ('rules', 'is_enabled') é obrigatório"}), 400
     
-    values.append(flag_name) # Adiciona o 'flag_name' para a cláusula WHERE
+    values.extend([flag_name, environment]) # Adiciona o 'flag_name' e o ambiente para a cláusula WHERE
     
-    query = f"UPDATE targeting_rules SET {', '.join(fields)} WHERE flag_name = %s RETURNING *"
+    query = f"UPDATE targeting_rules SET {', '.join(fields)} WHERE flag_name = %s AND environment = %s RETURNING *"
     
     conn = None
     cur = None
     try:
         conn = pool.getconn()
         cur = conn.cursor(cursor_factory=RealDictCursor)
+        
+        # Flags da mesma camada não podem dividir usuários
+        if isinstance(rules_obj, dict) and rules_obj.get('layer'):
+            conflict = find_layer_conflict(cur, environment, flag_name, rules_obj['layer'])
+            if conflict:
+                return jsonify({"error": f"A fatia da camada '{rules_obj['layer']['name']}' se sobrepõe à da flag '{conflict}'"}), 409
+        
         cur.execute(query, tuple(values))
         
         if cur.rowcount == 0:
@@ -176,14 +323,15 @@ def update_rule(flag_name):
 
 @app.route('/rules/<string:flag_name>', methods=['DELETE'])
 @require_auth
-def delete_rule(flag_name):
+@with_environment
+def delete_rule(flag_name, environment):
     """ Deleta a regra de segmentação de uma flag """
     conn = None
     cur = None
     try:
         conn = pool.getconn()
         cur = conn.cursor()
-        cur.execute("DELETE FROM targeting_rules WHERE flag_name = %s", (flag_name,))
+        cur.execute("DELETE FROM targeting_rules WHERE flag_name = %s AND environment = %s", (flag_name, environment))
         
         if cur.rowcount == 0:
             return jsonify({"error": "Regra não encontrada"}), 404
@@ -199,6 +347,335 @@ def delete_rule(flag_name):
         if cur: cur.close()
         if conn: pool.putconn(conn)
 
+@app.route('/layers/<string:name>', methods=['GET'])
+@require_auth
+@with_environment
+def get_layer(name, environment):
+    """ Lista as fatias ocupadas em uma camada de experimentos (para achar espaço livre) """
+    conn = None
+    cur = None
+    try:
+        conn = pool.getconn()
+        cur = conn.cursor(cursor_factory=RealDictCursor)
+        cur.execute(
+            "SELECT flag_name, is_enabled, COALESCE((rules->'layer'->>'start')::numeric, 0) AS start, "
+            "(rules->'layer'->>'end')::numeric AS end FROM targeting_rules "
+            "WHERE environment = %s AND rules->'layer'->>'name' = %s ORDER BY start",
+            (environment, name)
+        )
+        allocations = cur.fetchall()
+        for allocation in allocations:
+            allocation['start'] = float(allocation['start'])
+            allocation['end'] = float(allocation['end'])
+        return jsonify({"name": name, "allocations": allocations})
+    except Exception as e:
+        log.error(f"Erro ao buscar camada '{name}': {e}")
+        return jsonify({"error": "Erro interno do servidor", "details": str(e)}), 500
+    finally:
+        if cur: cur.close()
+        if conn: pool.putconn(conn)
+
+# --- Segmentos ---
+
+def validate_segment(data):
+    """ Valida os campos de lista de um segmento. Retorna a mensagem de erro ou None """
+    for field in ('included', 'excluded', 'rules'):
+        if field in data and not isinstance(data[field], list):
+            return f"'{field}' deve ser uma lista"
+    return None
+
+def segment_rule_set(rules):
+    """ Monta com as regras do segmento o formato de 'rules' aceito pelo validate_rules """
+    return {"rules": [{"id": f"rule-{i + 1}", "condition": rule} for i, rule in enumerate(rules)]}
+
+@app.route('/segments', methods=['POST'])
+@require_auth
+@with_environment
+def create_segment(environment):
+    """ Cria um novo segmento reutilizável """
+    data = request.get_json()
+    if not data or 'name' not in data:
+        return jsonify({"error": "'name' é obrigatório"}), 400
+    
+    error = validate_segment(data)
+    if error:
+        return jsonify({"error": error}), 400
+    if 'rules' in data:
+        invalid = validate_rules(segment_rule_set(data['rules']))
+        if invalid:
+            return invalid
+    
+    name = data['name']
+    conn = None
+    cur = None
+    try:
+        conn = pool.getconn()
+        cur = conn.cursor(cursor_factory=RealDictCursor)
+        cur.execute(
+            "INSERT INTO segments (name, environment, description, included, excluded, rules, created_at, updated_at) "
+            "VALUES (%s, %s, %s, %s, %s, %s, NOW(), NOW()) RETURNING *",
+            (name, environment, data.get('description', ''), Json(data.get('included', [])),
+             Json(data.get('excluded', [])), Json(data.get('rules', [])))
+        )
+        new_segment = cur.fetchone()
+        conn.commit()
+        log.info(f"Segmento '{name}' criado com sucesso no ambiente '{environment}'.")
+        return jsonify(new_segment), 201
+    except psycopg2.IntegrityError:
+        if conn: conn.rollback()
+        log.warning(f"Tentativa de criar segmento duplicado: '{name}' ({environment})")
+        return jsonify({"error": f"Segmento '{name}' já existe no ambiente '{environment}'"}), 409
+    except Exception as e:
+        if conn: conn.rollback()
+        log.error(f"Erro ao criar segmento: {e}")
+        return jsonify({"error": "Erro interno do servidor", "details": str(e)}), 500
+    finally:
+        if cur: cur.close()
+        if conn: pool.putconn(conn)
+
+@app.route('/segments', methods=['GET'])
+@require_auth
+@with_environment
+def get_segments(environment):
+    """ Lista todos os segmentos do ambiente """
+    conn = None
+    cur = None
+    try:
+        conn = pool.getconn()
+        cur = conn.cursor(cursor_factory=RealDictCursor)
+        cur.execute("SELECT * FROM segments WHERE environment = %s ORDER BY name", (environment,))
+        segments = cur.fetchall()
+        return jsonify(segments)
+    except Exception as e:
+        log.error(f"Erro ao buscar segmentos: {e}")
+        return jsonify({"error": "Erro interno do servidor", "details": str(e)}), 500
+    finally:
+        if cur: cur.close()
+        if conn: pool.putconn(conn)
+
+@app.route('/segments/<string:name>', methods=['GET'])
+@require_auth
+@with_environment
+def get_segment(name, environment):
+    """ Busca um segmento pelo nome """
+    conn = None
+    cur = None
+    try:
+        conn = pool.getconn()
+        cur = conn.cursor(cursor_factory=RealDictCursor)
+        cur.execute("SELECT * FROM segments WHERE name = %s AND environment = %s", (name, environment))
+        segment = cur.fetchone()
+        if not segment:
+            return jsonify({"error": "Segmento não encontrado"}), 404
+        return jsonify(segment)
+    except Exception as e:
+        log.error(f"Erro ao buscar segmento '{name}': {e}")
+        return jsonify({"error": "Erro interno do servidor", "details": str(e)}), 500
+    finally:
+        if cur: cur.close()
+        if conn: pool.putconn(conn)
+
+@app.route('/segments/<string:name>', methods=['PUT'])
+@require_auth
+@with_environment
+def update_segment(name, environment):
+    """ Atualiza um segmento (descrição, listas de usuários ou regras) """
+    data = request.get_json()
+    if not data:
+        return jsonify({"error": "Corpo da requisição obrigatório"}), 400
+    
+    error = validate_segment(data)
+    if error:
+        return jsonify({"error": error}), 400
+    if 'rules' in data:
+        invalid = validate_rules(segment_rule_set(data['rules']))
+        if invalid:
+            return invalid
+
+    fields = []
+    values = []
+    
+    if 'description' in data:
+        fields.append("description = %s")
+        values.append(data['description'])
+    for field in ('included', 'excluded', 'rules'):
+        if field in data:
+            fields.append(f"{field} = %s")
+            values.append(Json(data[field]))
+    
+    if not fields:
+        return jsonify({"error": "Pelo menos um campo ('description', 'included', 'excluded', 'rules') é obrigatório"}), 400
+    
+    values.extend([name, environment]) # Adiciona o 'name' e o ambiente para a cláusula WHERE
+    
+    query = f"UPDATE segments SET {', '.join(fields)} WHERE name = %s AND environment = %s RETURNING *"
+    
+    conn = None
+    cur = None
+    try:
+        conn = pool.getconn()
+        cur = conn.cursor(cursor_factory=RealDictCursor)
+        cur.execute(query, tuple(values))
+        
+        if cur.rowcount == 0:
+            return jsonify({"error": "Segmento não encontrado"}), 404
+            
+        updated_segment = cur.fetchone()
+        conn.commit()
+        log.info(f"Segmento '{name}' atualizado com sucesso.")
+        return jsonify(updated_segment), 200
+    except Exception as e:
+        if conn: conn.rollback()
+        log.error(f"Erro ao atualizar segmento '{name}': {e}")
+        return jsonify({"error": "Erro interno do servidor", "details": str(e)}), 500
+    finally:
+        if cur: cur.close()
+        if conn: pool.putconn(conn)
+
+@app.route('/segments/<string:name>', methods=['DELETE'])
+@require_auth
+@with_environment
+def delete_segment(name, environment):
+    """ Deleta um segmento """
+    conn = None
+    cur = None
+    try:
+        conn = pool.getconn()
+        cur = conn.cursor()
+        cur.execute("DELETE FROM segments WHERE name = %s AND environment = %s", (name, environment))
+        
+        if cur.rowcount == 0:
+            return jsonify({"error": "Segmento não encontrado"}), 404
+            
+        conn.commit()
+        log.info(f"Segmento '{name}' deletado com sucesso.")
+        return "", 204 # 204 No Content
+    except Exception as e:
+        if conn: conn.rollback()
+        log.error(f"Erro ao deletar segmento '{name}': {e}")
+        return jsonify({"error": "Erro interno do servidor", "details": str(e)}), 500
+    finally:
+        if cur: cur.close()
+        if conn: pool.putconn(conn)
+
+# --- Overrides por usuário ---
+
+def serialize_override(override):
+    """ Datas em ISO 8601 (o evaluation-service lê o 'expires_at') """
+    for field in ('expires_at', 'created_at', 'updated_at'):
+        if override.get(field):
+            override[field] = override[field].isoformat()
+    return override
+
+def parse_expires_at(value):
+    """ Converte o 'expires_at' (ISO 8601) para datetime. Sem fuso, assume UTC """
+    expires_at = datetime.fromisoformat(value)
+    if expires_at.tzinfo is None:
+        expires_at = expires_at.replace(tzinfo=timezone.utc)
+    return expires_at
+
+@app.route('/overrides', methods=['GET'])
+@require_auth
+@with_environment
+def get_overrides(environment):
+    """ Lista os overrides ainda válidos do ambiente (todos, ou de uma flag com ?flag_name=) """
+    flag_name = request.args.get('flag_name')
+    query = "SELECT * FROM flag_overrides WHERE environment = %s AND (expires_at IS NULL OR expires_at > NOW())"
+    params = (environment,)
+    if flag_name:
+        query += " AND flag_name = %s"
+        params = (environment, flag_name)
+    query += " ORDER BY flag_name, user_key"
+
+    conn = None
+    cur = None
+    try:
+        conn = pool.getconn()
+        cur = conn.cursor(cursor_factory=RealDictCursor)
+        cur.execute(query, params)
+        overrides = cur.fetchall()
+        return jsonify([serialize_override(o) for o in overrides])
+    except Exception as e:
+        log.error(f"Erro ao buscar overrides: {e}")
+        return jsonify({"error": "Erro interno do servidor", "details": str(e)}), 500
+    finally:
+        if cur: cur.close()
+        if conn: pool.putconn(conn)
+
+@app.route('/overrides/<string:flag_name>/<string:user_key>', methods=['PUT'])
+@require_auth
+@with_environment
+def put_override(flag_name, user_key, environment):
+    """ Cria ou substitui o override de um usuário em uma flag """
+    data = request.get_json(silent=True) or {}
+
+    enabled = data.get('enabled', True)
+    if not isinstance(enabled, bool):
+        return jsonify({"error": "'enabled' deve ser booleano"}), 400
+    variation = data.get('variation')
+    if variation is not None and not isinstance(variation, str):
+        return jsonify({"error": "'variation' deve ser uma string"}), 400
+
+    expires_at = None
+    if data.get('expires_at'):
+        try:
+            expires_at = parse_expires_at(data['expires_at'])
+        except (TypeError, ValueError):
+            return jsonify({"error": "'expires_at' deve estar no formato ISO 8601 (ex: 2026-11-03T18:00:00Z)"}), 400
+        if expires_at <= datetime.now(timezone.utc):
+            return jsonify({"error": "'expires_at' deve estar no futuro"}), 400
+
+    conn = None
+    cur = None
+    try:
+        conn = pool.getconn()
+        cur = conn.cursor(cursor_factory=RealDictCursor)
+        cur.execute(
+            "INSERT INTO flag_overrides (flag_name, environment, user_key, enabled, variation, expires_at, note) "
+            "VALUES (%s, %s, %s, %s, %s, %s, %s) "
+            "ON CONFLICT (flag_name, environment, user_key) DO UPDATE SET enabled = EXCLUDED.enabled, "
+            "variation = EXCLUDED.variation, expires_at = EXCLUDED.expires_at, note = EXCLUDED.note "
+            "RETURNING *",
+            (flag_name, environment, user_key, enabled, variation, expires_at, data.get('note'))
+        )
+        override = cur.fetchone()
+        conn.commit()
+        log.info(f"Override de '{user_key}' na flag '{flag_name}' salvo com sucesso.")
+        return jsonify(serialize_override(override)), 200
+    except Exception as e:
+        if conn: conn.rollback()
+        log.error(f"Erro ao salvar override: {e}")
+        return jsonify({"error": "Erro interno do servidor", "details": str(e)}), 500
+    finally:
+        if cur: cur.close()
+        if conn: pool.putconn(conn)
+
+@app.route('/overrides/<string:flag_name>/<string:user_key>', methods=['DELETE'])
+@require_auth
+@with_environment
+def delete_override(flag_name, user_key, environment):
+    """ Remove o override de um usuário em uma flag """
+    conn = None
+    cur = None
+    try:
+        conn = pool.getconn()
+        cur = conn.cursor()
+        cur.execute("DELETE FROM flag_overrides WHERE flag_name = %s AND environment = %s AND user_key = %s", (flag_name, environment, user_key))
+        
+        if cur.rowcount == 0:
+            return jsonify({"error": "Override não encontrado"}), 404
+            
+        conn.commit()
+        log.info(f"Override de '{user_key}' na flag '{flag_name}' removido com sucesso.")
+        return "", 204 # 204 No Content
+    except Exception as e:
+        if conn: conn.rollback()
+        log.error(f"Erro ao remover override: {e}")
+        return jsonify({"error": "Erro interno do servidor", "details": str(e)}), 500
+    finally:
+        if cur: cur.close()
+        if conn: pool.putconn(conn)
+
 if __name__ == '__main__':
     port = int(os.getenv("PORT", 8003))
     app.run(host='0.0.0.0', port=port, debug=False)
\ No newline at end of file
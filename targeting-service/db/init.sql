@@ -1,22 +1,39 @@
 CREATE TABLE IF NOT EXISTS targeting_rules (
     id SERIAL PRIMARY KEY,
 
-    -- 'flag_name' é a chave de negócio única. 
-    -- Cada flag pode ter no máximo UMA regra de segmentação.
-    flag_name VARCHAR(100) UNIQUE NOT NULL,
+    -- 'flag_name' é a chave de negócio, única por ambiente.
+    -- Cada flag tem no máximo UM registro por ambiente, que guarda a lista ordenada de regras.
+    flag_name VARCHAR(100) NOT NULL,
+    
+    -- Ambiente da regra (ex: 'development', 'staging', 'production'), o mesmo da flag no flag-service
+    environment VARCHAR(50) NOT NULL DEFAULT 'production',
     
     -- Se a regra de segmentação em si está ativa ou não
     is_enabled BOOLEAN NOT NULL DEFAULT true,
     
     -- Armazena a lógica da regra como um JSON.
+    -- Formato completo: lista ordenada de regras (a primeira atendida vence)
+    -- Ex: {"rules": [{"id": "staff", "condition": {"type": "USER_LIST", "values": ["u1"]}, "outcome": {"enabled": true}},
+    --                {"id": "brasil", "condition": {...}, "outcome": {"enabled": true}}],
+    --      "fallthrough": {"enabled": false}}
+    -- Formato simples (uma única regra):
     -- Ex: {"type": "PERCENTAGE", "value": 50}
     -- Ex: {"type": "USER_LIST", "values": ["u1", "u2"]}
+    -- Ex: {"type": "PERCENTAGE", "value": 50, "exclude": ["u3"]}
+    -- Ex: {"type": "AND", "rules": [{"type": "ATTRIBUTE", "clauses": [...]}, {"type": "PERCENTAGE", "value": 20}]}
+    -- Camada de experimentos (exclusão mútua entre flags da mesma camada):
+    -- Ex: {"layer": {"name": "pricing", "start": 0, "end": 50}, "rules": [...]}
     rules JSONB NOT NULL,
     
     created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
 );
 
+-- Para bancos criados antes dos ambientes: o nome da flag passa a ser único POR AMBIENTE
+ALTER TABLE targeting_rules ADD COLUMN IF NOT EXISTS environment VARCHAR(50) NOT NULL DEFAULT 'production';
+ALTER TABLE targeting_rules DROP CONSTRAINT IF EXISTS targeting_rules_flag_name_key;
+CREATE UNIQUE INDEX IF NOT EXISTS targeting_rules_flag_name_environment_key ON targeting_rules (flag_name, environment);
+
 -- Trigger para atualizar 'updated_at' automaticamente (igual ao do flag-service)
 CREATE OR REPLACE FUNCTION trigger_set_timestamp()
 RETURNS TRIGGER AS $$
@@ -31,4 +48,81 @@ DROP TRIGGER IF EXISTS set_timestamp ON targeting_rules;
 CREATE TRIGGER set_timestamp
 BEFORE UPDATE ON targeting_rules
 FOR EACH ROW
-EXECUTE PROCEDURE trigger_set_timestamp();
\ No newline at end of file
+EXECUTE PROCEDURE trigger_set_timestamp();
+
+-- Segmentos reutilizáveis (ex: "funcionarios", "beta-testers").
+-- As regras referenciam o segmento pelo nome: {"type": "SEGMENT", "values": ["beta-testers"]}
+-- Assim, uma mudança no segmento vale para todas as flags que o usam no mesmo ambiente.
+CREATE TABLE IF NOT EXISTS segments (
+    id SERIAL PRIMARY KEY,
+
+    -- 'name' é a chave de negócio, única por ambiente
+    name VARCHAR(100) NOT NULL,
+
+    -- Ambiente do segmento (o mesmo das regras que o referenciam)
+    environment VARCHAR(50) NOT NULL DEFAULT 'production',
+
+    description TEXT,
+
+    -- Usuários sempre dentro do segmento. Ex: ["u1", "u2"]
+    included JSONB NOT NULL DEFAULT '[]'::jsonb,
+
+    -- Usuários sempre fora do segmento (vence o 'included' e as regras). Ex: ["u3"]
+    excluded JSONB NOT NULL DEFAULT '[]'::jsonb,
+
+    -- Regras de atributo: o usuário está no segmento se atender QUALQUER uma.
+    -- Ex: [{"type": "ATTRIBUTE", "clauses": [{"attribute": "email", "operator": "endsWith", "values": ["@empresa.com"]}]}]
+    rules JSONB NOT NULL DEFAULT '[]'::jsonb,
+
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Para bancos criados antes dos ambientes: o nome do segmento passa a ser único POR AMBIENTE
+ALTER TABLE segments ADD COLUMN IF NOT EXISTS environment VARCHAR(50) NOT NULL DEFAULT 'production';
+ALTER TABLE segments DROP CONSTRAINT IF EXISTS segments_name_key;
+CREATE UNIQUE INDEX IF NOT EXISTS segments_name_environment_key ON segments (name, environment);
+
+DROP TRIGGER IF EXISTS set_timestamp ON segments;
+
+CREATE TRIGGER set_timestamp
+BEFORE UPDATE ON segments
+FOR EACH ROW
+EXECUTE PROCEDURE trigger_set_timestamp();
+
+-- Overrides forçados por usuário (ex: QA forçando um usuário/dispositivo em uma variação).
+-- São consultados ANTES de qualquer regra, sem editar a regra compartilhada da flag.
+CREATE TABLE IF NOT EXISTS flag_overrides (
+    id SERIAL PRIMARY KEY,
+
+    flag_name VARCHAR(100) NOT NULL,
+
+    -- Ambiente do override (o mesmo da flag)
+    environment VARCHAR(50) NOT NULL DEFAULT 'production',
+
+    -- Chave do contexto de avaliação (ID do usuário ou do dispositivo)
+    user_key VARCHAR(255) NOT NULL,
+
+    -- Resultado forçado e, para flags multivariadas, a variação (opcional)
+    enabled BOOLEAN NOT NULL DEFAULT true,
+    variation VARCHAR(100),
+
+    -- Após esta data o override é ignorado (NULL = não expira)
+    expires_at TIMESTAMP WITH TIME ZONE,
+
+    -- Motivo/responsável, para auditoria (ex: "QA - ticket 123")
+    note TEXT,
+
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+
+    -- No máximo um override por flag, ambiente e usuário
+    UNIQUE (flag_name, environment, user_key)
+);
+
+DROP TRIGGER IF EXISTS set_timestamp ON flag_overrides;
+
+CREATE TRIGGER set_timestamp
+BEFORE UPDATE ON flag_overrides
+FOR EACH ROW
+EXECUTE PROCEDURE trigger_set_timestamp();